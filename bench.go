@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// benchResult is the outcome of translating the sample at one worker count.
+type benchResult struct {
+	workers   int
+	elapsed   time.Duration
+	latencies []time.Duration
+	errors    int
+}
+
+// runBenchCommand translates a sample at several worker counts against the
+// configured provider and compares throughput, latency and errors:
+// `bench [--workers 1,2,4,8] [--lines n] [file]`. The cache is bypassed.
+func runBenchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	workerList := fs.String("workers", "1,2,4,8,16", "Comma-separated worker counts to try")
+	maxLines := fs.Int("lines", 100, "Number of lines to translate per worker count")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || *maxLines <= 0 {
+		return errors.New("usage: bench [--workers 1,2,4] [--lines n] [subtitle file]")
+	}
+	var counts []int
+	for _, s := range strings.Split(*workerList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid worker count %q", s)
+		}
+		counts = append(counts, n)
+	}
+
+	langs := parseLangs(targetLang)
+	if len(langs) == 0 {
+		return errors.New("please specify a target language with --lang")
+	}
+	lang := langs[0]
+	if err := selectProvider(); err != nil {
+		return err
+	}
+	if err := validateLanguages(sourceLang, langs[:1]); err != nil {
+		return err
+	}
+	if err := loadPromptSettings(langs[:1]); err != nil {
+		return err
+	}
+
+	sample, err := benchSample(fs.Arg(0), *maxLines)
+	if err != nil {
+		return err
+	}
+	statusf("🏁 Benchmarking %s %s → %s with %d lines\n", providerName, sourceLang, lang, len(sample))
+
+	var results []benchResult
+	for _, n := range counts {
+		r := benchRun(sample, lang, n)
+		if err := aborted(); err != nil {
+			return err
+		}
+		statusf("  %d worker(s): %v\n", n, r.elapsed.Round(time.Millisecond))
+		results = append(results, r)
+	}
+	printBenchResults(results, len(sample))
+	return nil
+}
+
+// benchSample takes the translatable lines of a subtitle, or builds a
+// synthetic corpus from the self-test sentences. Lines are numbered so no
+// two requests are identical.
+func benchSample(path string, n int) ([]string, error) {
+	var lines []string
+	if path != "" {
+		doc, _, err := readSubtitle(path, inputFPS)
+		if err != nil {
+			return nil, err
+		}
+		for _, cue := range doc.cues() {
+			for i := range cue.lines {
+				if _, ok := cue.translatableText(i); ok && len(lines) < n {
+					lines = append(lines, strings.TrimSpace(cue.lines[i]))
+				}
+			}
+		}
+		if len(lines) == 0 {
+			return nil, fmt.Errorf("%s has no text to translate", path)
+		}
+		return lines, nil
+	}
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, selfTestSentences[i%len(selfTestSentences)]))
+	}
+	return lines, nil
+}
+
+func benchRun(sample []string, lang string, workers int) benchResult {
+	r := benchResult{workers: workers}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := semaphore.NewWeighted(int64(workers))
+	start := time.Now()
+	for _, text := range sample {
+		if err := sem.Acquire(runCtx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			t := time.Now()
+			_, err := provider.translate(text, sourceLang, lang)
+			latency := time.Since(t)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				r.errors++
+				logError(fmt.Sprintf("Bench error with %d worker(s): '%s' — %v", workers, text, err))
+				return
+			}
+			r.latencies = append(r.latencies, latency)
+		}(text)
+	}
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r
+}
+
+// percentile of sorted latencies, 0 if there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+// printBenchResults prints a table and recommends the fastest setting
+// without errors, or with the fewest if every setting had some.
+func printBenchResults(results []benchResult, lines int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\nworkers\tlines/s\tp50\tp95\tmax\terrors\t")
+	best := -1
+	for i, r := range results {
+		throughput := float64(len(r.latencies)) / r.elapsed.Seconds()
+		fmt.Fprintf(w, "%d\t%.1f\t%v\t%v\t%v\t%.1f%%\t\n", r.workers, throughput,
+			percentile(r.latencies, 0.5).Round(time.Millisecond),
+			percentile(r.latencies, 0.95).Round(time.Millisecond),
+			percentile(r.latencies, 1).Round(time.Millisecond),
+			float64(r.errors)/float64(lines)*100)
+		if best < 0 || r.errors < results[best].errors ||
+			r.errors == results[best].errors && throughput > float64(len(results[best].latencies))/results[best].elapsed.Seconds() {
+			best = i
+		}
+	}
+	_ = w.Flush()
+	if best >= 0 {
+		fmt.Printf("\n💡 Best setting: --workers %d\n", results[best].workers)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// minRateSample is how many lines must have been attempted before
+// --max-error-rate is enforced, so one early failure does not abort the run.
+const minRateSample = 20
+
+var errTooManyErrors = errors.New("too many errors")
+
+// runCtx is cancelled when the error budget is exhausted. Everything that
+// waits for work or talks to the API derives from it, so an abort stops new
+// files and lines from starting and cancels requests in flight.
+var runCtx, abortRun = context.WithCancelCause(context.Background())
+
+var failedFileCount int64
+
+// checkErrorBudget aborts the run once the failed lines and files exceed
+// --max-errors, or the share of failed lines exceeds --max-error-rate.
+func checkErrorBudget() {
+	failedLines := atomic.LoadInt64(&failedLineCount)
+	failed := failedLines + atomic.LoadInt64(&failedFileCount)
+	if maxErrors > 0 && failed > int64(maxErrors) {
+		abortRun(fmt.Errorf("%w: %d failures exceed --max-errors %d", errTooManyErrors, failed, maxErrors))
+		return
+	}
+
+	if maxErrorRate > 0 {
+		attempted := atomic.LoadInt64(&lineCounter) + failedLines
+		if attempted >= minRateSample && float64(failedLines)/float64(attempted) > maxErrorRate {
+			abortRun(fmt.Errorf("%w: %d of %d lines failed, above --max-error-rate %g", errTooManyErrors, failedLines, attempted, maxErrorRate))
+		}
+	}
+}
+
+// aborted reports why the run was aborted, or nil if it was not.
+func aborted() error {
+	return context.Cause(runCtx)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Per-run cache statistics, reported in the run summary.
+var (
+	memoryCacheHits     int64
+	persistentCacheHits int64
+	cacheMisses         int64
+	cacheCharsSaved     int64
+)
+
+// cacheKey identifies a cached translation in translationCache.
+type cacheKey struct {
+	engine string // see cacheEngine
+	source string
+	target string
+	text   string
+}
+
+// cacheValue is what translationCache stores for a cacheKey. persisted marks
+// entries that were loaded from the cache file rather than translated this run.
+type cacheValue struct {
+	translated string
+	persisted  bool
+}
+
+// cacheEntries is the on-disk form of the translation cache:
+// language pair ("en:ru", "ollama/qwen2.5:en:ru") -> source text ->
+// translated text.
+type cacheEntries map[string]map[string]string
+
+// cacheEngine names what translations come from, so switching --provider
+// or --model does not serve translations of another engine. LibreTranslate
+// has none, which keeps caches written before the other providers valid.
+func cacheEngine() string {
+	if providerName == "libretranslate" {
+		return ""
+	}
+	return providerName + "/" + llmModel
+}
+
+func pairKey(engine, source, target string) string {
+	if engine == "" {
+		return source + ":" + target
+	}
+	return engine + ":" + source + ":" + target
+}
+
+// splitPairKey splits a pair from the right, as model names such as
+// qwen2.5:7b contain colons themselves.
+func splitPairKey(pair string) (engine, source, target string, ok bool) {
+	rest, target, ok := cutLast(pair, ":")
+	if !ok {
+		return "", "", "", false
+	}
+	engine, source, found := cutLast(rest, ":")
+	if !found {
+		engine, source = "", rest
+	}
+	return engine, source, target, source != "" && target != ""
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func (e cacheEntries) count() int {
+	n := 0
+	for _, texts := range e {
+		n += len(texts)
+	}
+	return n
+}
+
+// merge copies all entries from other into e, overriding existing translations.
+func (e cacheEntries) merge(other cacheEntries) {
+	for pair, texts := range other {
+		if e[pair] == nil {
+			e[pair] = make(map[string]string, len(texts))
+		}
+		for text, translated := range texts {
+			e[pair][text] = translated
+		}
+	}
+}
+
+func decodeCacheEntries(r io.Reader) (cacheEntries, error) {
+	entries := cacheEntries{}
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+	for pair := range entries {
+		if _, _, _, ok := splitPairKey(pair); !ok {
+			return nil, fmt.Errorf("invalid language pair %q, expected \"source:target\" or \"provider/model:source:target\"", pair)
+		}
+	}
+	return entries, nil
+}
+
+func encodeCacheEntries(w io.Writer, entries cacheEntries) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// Subtitles are full of <i> and & — keep them readable for hand editing.
+	enc.SetEscapeHTML(false)
+	return enc.Encode(entries)
+}
+
+func readCacheFile(path string) (cacheEntries, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logError(fmt.Sprintf("Failed to close cache file %s: %v", path, err))
+		}
+	}()
+
+	entries, err := decodeCacheEntries(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func writeCacheFile(path string, entries cacheEntries) error {
+	var buf bytes.Buffer
+	if err := encodeCacheEntries(&buf, entries); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// loadCache fills translationCache from the persistent cache file.
+// A missing file is not an error: it is simply created on the first save.
+func loadCache(path string) (int, error) {
+	entries, err := readCacheFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for pair, texts := range entries {
+		engine, source, target, _ := splitPairKey(pair)
+		for text, translated := range texts {
+			translationCache.Store(cacheKey{engine: engine, source: source, target: target, text: text}, cacheValue{translated: translated, persisted: true})
+		}
+	}
+	return entries.count(), nil
+}
+
+func snapshotCache() cacheEntries {
+	entries := cacheEntries{}
+	translationCache.Range(func(k, v any) bool {
+		key := k.(cacheKey)
+		pair := pairKey(key.engine, key.source, key.target)
+		if entries[pair] == nil {
+			entries[pair] = make(map[string]string)
+		}
+		entries[pair][key.text] = v.(cacheValue).translated
+		return true
+	})
+	return entries
+}
+
+// lookupCache returns a cached translation and records the hit or miss.
+func lookupCache(key cacheKey) (string, bool) {
+	val, ok := translationCache.Load(key)
+	if !ok {
+		atomic.AddInt64(&cacheMisses, 1)
+		return "", false
+	}
+
+	entry := val.(cacheValue)
+	if entry.persisted {
+		atomic.AddInt64(&persistentCacheHits, 1)
+	} else {
+		atomic.AddInt64(&memoryCacheHits, 1)
+	}
+	atomic.AddInt64(&cacheCharsSaved, int64(utf8.RuneCountInString(key.text)))
+	return entry.translated, true
+}
+
+func storeCache(key cacheKey, translated string) {
+	translationCache.Store(key, cacheValue{translated: translated})
+}
+
+func cacheSummary() string {
+	memory := atomic.LoadInt64(&memoryCacheHits)
+	persistent := atomic.LoadInt64(&persistentCacheHits)
+	hits := memory + persistent
+	misses := atomic.LoadInt64(&cacheMisses)
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses) * 100
+	}
+	return fmt.Sprintf(tr("%d hits (%d persistent, %d in-memory), %d misses, %.1f%% hit ratio, %d characters saved"),
+		hits, persistent, memory, misses, ratio, atomic.LoadInt64(&cacheCharsSaved))
+}
+
+func saveCache(path string) error {
+	return writeCacheFile(path, snapshotCache())
+}
+
+func runCacheCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cache export [file] | cache import <file>")
+	}
+
+	switch args[0] {
+	case "export":
+		return exportCache(args[1:])
+	case "import":
+		return importCache(args[1:])
+	default:
+		return fmt.Errorf("unknown cache command %q", args[0])
+	}
+}
+
+// exportCache writes the persistent cache as indented JSON to a file or stdout.
+func exportCache(args []string) error {
+	entries, err := readCacheFile(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		entries = cacheEntries{}
+	} else if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		return encodeCacheEntries(os.Stdout, entries)
+	}
+	if err := writeCacheFile(args[0], entries); err != nil {
+		return err
+	}
+	statusf("📤 Exported %d cached translations to %s\n", entries.count(), args[0])
+	return nil
+}
+
+// importCache merges a JSON export into the persistent cache. Imported
+// translations win, so hand-corrected entries replace the machine ones.
+func importCache(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: cache import <file>")
+	}
+
+	var imported cacheEntries
+	var err error
+	if args[0] == "-" {
+		imported, err = decodeCacheEntries(os.Stdin)
+	} else {
+		imported, err = readCacheFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	entries, err := readCacheFile(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		entries = cacheEntries{}
+	} else if err != nil {
+		return err
+	}
+
+	entries.merge(imported)
+	if err := writeCacheFile(cachePath, entries); err != nil {
+		return err
+	}
+	statusf("📥 Imported %d translations into %s (%d total)\n", imported.count(), cachePath, entries.count())
+	return nil
+}
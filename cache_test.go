@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPairKey(t *testing.T) {
+	tests := []struct {
+		pair                   string
+		engine, source, target string
+		ok                     bool
+	}{
+		{"en:ru", "", "en", "ru", true},
+		{"ollama/qwen2.5:en:ru", "ollama/qwen2.5", "en", "ru", true},
+		{"ollama/qwen2.5:7b:en:pt-BR", "ollama/qwen2.5:7b", "en", "pt-BR", true},
+		{"huggingface/Helsinki-NLP/opus-mt-en-ru:en:ru", "huggingface/Helsinki-NLP/opus-mt-en-ru", "en", "ru", true},
+		{pair: "enru"},
+		{pair: "en:"},
+		{pair: ":ru"},
+	}
+	for _, tt := range tests {
+		engine, source, target, ok := splitPairKey(tt.pair)
+		if !tt.ok {
+			if ok {
+				t.Errorf("splitPairKey(%q) accepted an invalid pair", tt.pair)
+			}
+			continue
+		}
+		if engine != tt.engine || source != tt.source || target != tt.target || !ok {
+			t.Errorf("splitPairKey(%q) = %q, %q, %q, %v, want %q, %q, %q", tt.pair, engine, source, target, ok, tt.engine, tt.source, tt.target)
+		}
+		if got := pairKey(engine, source, target); got != tt.pair {
+			t.Errorf("pairKey(%q, %q, %q) = %q, want %q", engine, source, target, got, tt.pair)
+		}
+	}
+}
+
+func TestCacheEngine(t *testing.T) {
+	defer func(name, model string) { providerName, llmModel = name, model }(providerName, llmModel)
+	tests := []struct {
+		provider, model, want string
+	}{
+		{"libretranslate", "", ""},
+		{"libretranslate", "gpt-4o", ""},
+		{"ollama", "qwen2.5", "ollama/qwen2.5"},
+		{"ollama", "llama3.1:8b", "ollama/llama3.1:8b"},
+		{"huggingface", "facebook/nllb-200-distilled-600M", "huggingface/facebook/nllb-200-distilled-600M"},
+	}
+	for _, tt := range tests {
+		providerName, llmModel = tt.provider, tt.model
+		if got := cacheEngine(); got != tt.want {
+			t.Errorf("cacheEngine() with %s %q = %q, want %q", tt.provider, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCacheEntries(t *testing.T) {
+	entries, err := decodeCacheEntries(strings.NewReader(`{"en:ru": {"Hello": "Привет"}, "ollama/qwen2.5:7b:en:ru": {"Hello": "Здравствуйте"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries.count() != 2 || entries["en:ru"]["Hello"] != "Привет" || entries["ollama/qwen2.5:7b:en:ru"]["Hello"] != "Здравствуйте" {
+		t.Errorf("entries = %v", entries)
+	}
+	if _, err := decodeCacheEntries(strings.NewReader(`{"english": {"Hello": "Привет"}}`)); err == nil {
+		t.Error("decodeCacheEntries accepted a pair without a colon")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON caption formats, named after their usual file extension: YouTube's
+// json3 (also saved as .json) and Amara's JSON export.
+const (
+	formatJSON  = "json"
+	formatJSON3 = "json3"
+)
+
+// errNotCaptions marks a .json, .srv3 or .sub file that is not in a known
+// caption format, such as a translation cache or VobSub images; directory
+// runs skip such files instead of failing them.
+var errNotCaptions = errors.New("not a caption file in a known format")
+
+// captionDocument is the parsed source of a structured caption file that
+// translated cues are written back into.
+type captionDocument interface {
+	render() string
+	// remove drops the source of a cue that was merged into another one
+	remove(cue *block)
+}
+
+// isCaptionDocument reports whether a file is read as a captionDocument
+// rather than as text subtitles.
+func isCaptionDocument(path string) bool {
+	switch subtitleFormat(path) {
+	case formatJSON, formatJSON3, formatSRV3:
+		return true
+	}
+	return false
+}
+
+// parseCaptionDocument parses a structured caption file in the given format.
+func parseCaptionDocument(format string, data []byte) (*subtitle, error) {
+	if format == formatSRV3 {
+		return parseSRV3(data)
+	}
+	return parseJSONCaptions(data)
+}
+
+// lineCount is the number of text lines of structured captions; unlike text
+// formats their progress is measured in cue lines, not file lines.
+func (s *subtitle) lineCount() int {
+	n := 0
+	for _, cue := range s.cues() {
+		n += len(cue.lines)
+	}
+	return n
+}
+
+// jsonCaptions keeps the decoded JSON document of a caption file, so
+// rendering writes back only the text and timing of cues and leaves all
+// other fields (pens, window positions, styling, metadata) untouched.
+type jsonCaptions struct {
+	root    any
+	youtube bool // json3 events rather than an Amara array
+	indent  bool
+	objects map[*block]*jsonCue
+	removed map[int]bool // indexes of events merged into others
+}
+
+// jsonCue links a cue to its JSON object and remembers what it was parsed
+// from, so unchanged cues are written back exactly as they were.
+type jsonCue struct {
+	obj   map[string]any
+	index int // position in the event array
+	lines []string
+	times cueTiming
+}
+
+// parseJSONCaptions reads YouTube json3 ({"events": [{"tStartMs",
+// "dDurationMs", "segs": [{"utf8"}]}]}) or an Amara export ([{"start",
+// "end", "text"}], in milliseconds).
+func parseJSONCaptions(data []byte) (*subtitle, error) {
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotCaptions, err)
+	}
+
+	captions := &jsonCaptions{root: root, indent: bytes.Contains(bytes.TrimSpace(data), []byte("\n")), objects: map[*block]*jsonCue{}}
+	doc := &subtitle{newline: "\n", captions: captions}
+	add := func(obj map[string]any, i int, start, end time.Duration, text string) {
+		t := cueTiming{start: start, end: end}
+		cue := &block{kind: blockCue, timing: t.String(), times: t, lines: strings.Split(text, "\n"), lineNo: i + 1}
+		doc.blocks = append(doc.blocks, cue)
+		captions.objects[cue] = &jsonCue{obj: obj, index: i, lines: slices.Clone(cue.lines), times: t}
+	}
+
+	switch root := root.(type) {
+	case map[string]any:
+		events, ok := root["events"].([]any)
+		if !ok {
+			return nil, errNotCaptions
+		}
+		captions.youtube = true
+		for i, e := range events {
+			event, ok := e.(map[string]any)
+			if !ok {
+				continue
+			}
+			text := strings.TrimSpace(youtubeText(event))
+			// Window and style definitions and appended line breaks carry no text
+			if text == "" {
+				continue
+			}
+			start := jsonMillis(event["tStartMs"])
+			add(event, i, start, start+jsonMillis(event["dDurationMs"]), text)
+		}
+	case []any:
+		// A bare [] is more likely some other tool's empty list
+		if len(root) == 0 {
+			return nil, errNotCaptions
+		}
+		for i, e := range root {
+			item, ok := e.(map[string]any)
+			if !ok {
+				return nil, errNotCaptions
+			}
+			text, ok := item["text"].(string)
+			if _, hasStart := item["start"]; !ok || !hasStart {
+				return nil, errNotCaptions
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			add(item, i, jsonMillis(item["start"]), jsonMillis(item["end"]), text)
+		}
+	default:
+		return nil, errNotCaptions
+	}
+	return doc, nil
+}
+
+// youtubeText joins the segments of a json3 event; auto-generated captions
+// have one segment per word.
+func youtubeText(event map[string]any) string {
+	segs, _ := event["segs"].([]any)
+	var sb strings.Builder
+	for _, s := range segs {
+		if seg, ok := s.(map[string]any); ok {
+			text, _ := seg["utf8"].(string)
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+func jsonMillis(v any) time.Duration {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0
+	}
+	ms, err := n.Float64()
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func millisNumber(d time.Duration) json.Number {
+	return json.Number(strconv.FormatInt(d.Round(time.Millisecond).Milliseconds(), 10))
+}
+
+// remove drops the event of a cue that was merged into another one.
+func (c *jsonCaptions) remove(cue *block) {
+	if jc, ok := c.objects[cue]; ok {
+		if c.removed == nil {
+			c.removed = map[int]bool{}
+		}
+		c.removed[jc.index] = true
+		delete(c.objects, cue)
+	}
+}
+
+// render writes changed cues back into the document. A translated json3
+// event gets one segment with the styling of its first segment, since
+// per-word timing offsets no longer apply to the translation.
+func (c *jsonCaptions) render() string {
+	for cue, jc := range c.objects {
+		if cue.times != jc.times {
+			if c.youtube {
+				jc.obj["tStartMs"] = millisNumber(cue.times.start)
+				jc.obj["dDurationMs"] = millisNumber(cue.times.end - cue.times.start)
+			} else {
+				jc.obj["start"] = millisNumber(cue.times.start)
+				jc.obj["end"] = millisNumber(cue.times.end)
+			}
+		}
+		if slices.Equal(cue.lines, jc.lines) {
+			continue
+		}
+		text := strings.Join(cue.lines, "\n")
+		if !c.youtube {
+			jc.obj["text"] = text
+			continue
+		}
+		seg := map[string]any{}
+		if segs, _ := jc.obj["segs"].([]any); len(segs) > 0 {
+			if first, ok := segs[0].(map[string]any); ok {
+				for k, v := range first {
+					seg[k] = v
+				}
+			}
+		}
+		delete(seg, "tOffsetMs")
+		delete(seg, "acAsrConf")
+		seg["utf8"] = text
+		jc.obj["segs"] = []any{seg}
+	}
+
+	root := c.root
+	if len(c.removed) > 0 {
+		keep := func(items []any) []any {
+			var kept []any
+			for i, item := range items {
+				if !c.removed[i] {
+					kept = append(kept, item)
+				}
+			}
+			return kept
+		}
+		switch r := root.(type) {
+		case map[string]any:
+			copied := make(map[string]any, len(r))
+			for k, v := range r {
+				copied[k] = v
+			}
+			copied["events"] = keep(r["events"].([]any))
+			root = copied
+		case []any:
+			root = keep(r)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if c.indent {
+		enc.SetIndent("", "  ")
+	}
+	// Every value came from decoding JSON, so encoding cannot fail
+	_ = enc.Encode(root)
+	return buf.String()
+}
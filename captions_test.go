@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONCaptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		times []cueTiming
+		lines [][]string
+	}{
+		{
+			name:  "json3",
+			data:  `{"wireMagic":"pb3","events":[{"tStartMs":0,"dDurationMs":5000,"id":1,"wpWinPosId":1},{"tStartMs":1000,"dDurationMs":1500,"wWinId":1,"segs":[{"utf8":"Hello "},{"utf8":"world","tOffsetMs":400}]},{"tStartMs":2500,"aAppend":1,"segs":[{"utf8":"\n"}]},{"tStartMs":3000,"dDurationMs":1000,"segs":[{"utf8":"Two\nlines"}]}]}`,
+			times: []cueTiming{{start: time.Second, end: 2500 * time.Millisecond}, {start: 3 * time.Second, end: 4 * time.Second}},
+			lines: [][]string{{"Hello world"}, {"Two", "lines"}},
+		},
+		{
+			name:  "amara",
+			data:  "\ufeff[{\"start\": 500, \"end\": 1500, \"text\": \"One\", \"meta\": {}}, {\"start\": 2000, \"end\": 3000, \"text\": \" \"}, {\"start\": 4000, \"end\": 5000, \"text\": \"Two\"}]",
+			times: []cueTiming{{start: 500 * time.Millisecond, end: 1500 * time.Millisecond}, {start: 4 * time.Second, end: 5 * time.Second}},
+			lines: [][]string{{"One"}, {"Two"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseJSONCaptions([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cues := doc.cues()
+			if len(cues) != len(tt.times) {
+				t.Fatalf("got %d cues, want %d", len(cues), len(tt.times))
+			}
+			for i, cue := range cues {
+				if cue.times != tt.times[i] || !slices.Equal(cue.lines, tt.lines[i]) {
+					t.Errorf("cue %d = %v %q, want %v %q", i, cue.times, cue.lines, tt.times[i], tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONCaptionsNotCaptions(t *testing.T) {
+	for _, data := range []string{
+		`[]`,
+		`{"files": {}}`,
+		`[{"source": "a", "target": "b"}]`,
+		`"text"`,
+		`not json`,
+	} {
+		if _, err := parseJSONCaptions([]byte(data)); !errors.Is(err, errNotCaptions) {
+			t.Errorf("parseJSONCaptions(%s) error = %v, want errNotCaptions", data, err)
+		}
+	}
+}
+
+func TestJSONCaptionsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "json3 keeps other fields",
+			data: `{"wireMagic":"pb3","events":[{"tStartMs":1000,"dDurationMs":1500,"wWinId":1,"segs":[{"utf8":"Hello ","pPenId":2},{"utf8":"world","tOffsetMs":400}]},{"tStartMs":3000,"dDurationMs":1000,"segs":[{"utf8":"Bye"}]}]}`,
+			want: `{"events":[{"dDurationMs":1500,"segs":[{"pPenId":2,"utf8":"Привет, <i>мир</i>"}],"tStartMs":1500,"wWinId":1},{"dDurationMs":1000,"segs":[{"utf8":"Bye"}],"tStartMs":3000}],"wireMagic":"pb3"}` + "\n",
+		},
+		{
+			name: "amara",
+			data: `[{"start":1000,"end":2500,"text":"Hello world","meta":{"speaker":"A"}},{"start":3000,"end":4000,"text":"Bye"}]`,
+			want: `[{"end":3000,"meta":{"speaker":"A"},"start":1500,"text":"Привет, <i>мир</i>"},{"end":4000,"start":3000,"text":"Bye"}]` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseJSONCaptions([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cue := doc.cues()[0]
+			cue.lines = []string{"Привет, <i>мир</i>"}
+			cue.setTimes(cue.times.start+500*time.Millisecond, cue.times.end+500*time.Millisecond)
+			if got := doc.render(); got != tt.want {
+				t.Errorf("render() =\n%s\nwant\n%s", got, tt.want)
+			}
+			again, err := parseJSONCaptions([]byte(doc.render()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := again.cues()[0]; got.times != cue.times || !slices.Equal(got.lines, cue.lines) {
+				t.Errorf("reparsed cue = %v %q, want %v %q", got.times, got.lines, cue.times, cue.lines)
+			}
+		})
+	}
+}
+
+func TestSRV3RoundTrip(t *testing.T) {
+	data := `<?xml version="1.0" encoding="utf-8" ?><timedtext format="3">
+<head><pen id="1" b="1"/></head>
+<body>
+<p t="0" d="5000" w="1"></p>
+<p t="1000" d="1500" w="1"><s>Hello</s><s t="400"> world</s></p>
+<p t="3000" d="1000">Two<br/>lines &amp; more</p>
+</body>
+</timedtext>
+`
+	doc, err := parseSRV3([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.render(); got != data {
+		t.Errorf("unchanged render() =\n%s\nwant\n%s", got, data)
+	}
+
+	cues := doc.cues()
+	if len(cues) != 2 || !slices.Equal(cues[0].lines, []string{"Hello world"}) || !slices.Equal(cues[1].lines, []string{"Two", "lines & more"}) {
+		t.Fatalf("cues = %q %q", cues[0].lines, cues[1].lines)
+	}
+	cues[0].lines = []string{"Привет & мир"}
+	cues[1].setTimes(3500*time.Millisecond, 4000*time.Millisecond)
+	want := strings.NewReplacer(
+		`<p t="1000" d="1500" w="1"><s>Hello</s><s t="400"> world</s></p>`, `<p t="1000" d="1500" w="1">Привет &amp; мир</p>`,
+		`<p t="3000" d="1000">`, `<p t="3500" d="500">`,
+	).Replace(data)
+	if got := doc.render(); got != want {
+		t.Errorf("render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseSRV3NotCaptions(t *testing.T) {
+	for _, data := range []string{
+		`<html><body><p>text</p></body></html>`,
+		`<timedtext><body><p t="0">unclosed`,
+		`plain text`,
+	} {
+		if _, err := parseSRV3([]byte(data)); !errors.Is(err, errNotCaptions) {
+			t.Errorf("parseSRV3(%q) error = %v, want errNotCaptions", data, err)
+		}
+	}
+}
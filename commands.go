@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// runCommand dispatches subcommands given as positional arguments after the
+// global flags, e.g. `vtt-translator --cache my.json cache export out.json`.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "bench":
+		return runBenchCommand(args[1:])
+	case "cache":
+		return runCacheCommand(args[1:])
+	case "merge":
+		return runMergeCommand(args[1:])
+	case "daemon":
+		return runDaemonCommand(args[1:])
+	case "jobs":
+		return runJobsCommand(args[1:])
+	case "completion":
+		return runCompletionCommand(args[1:])
+	case "languages":
+		return runLanguagesCommand(args[1:])
+	case "stats":
+		return runStatsCommand(args[1:])
+	case "selftest":
+		return runSelfTestCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
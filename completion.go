@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// commands lists the subcommands for completion.
+var commands = []string{"bench", "cache", "completion", "daemon", "jobs", "languages", "merge", "selftest", "stats"}
+
+// pathFlags take a file or directory.
+var pathFlags = []string{"input", "input-list", "endpoints", "output-dir", "cache", "state", "quality-report", "prompt-template", "glossary", "style-guide"}
+
+// flagValues are the fixed choices of enumerated flags.
+var flagValues = map[string][]string{
+	"provider":      {"libretranslate", "ollama", "huggingface"},
+	"chapters":      {"auto", "on", "off"},
+	"output-format": {"srt", "vtt"},
+	"preserve":      {"mode", "mtime", "owner"},
+	"ui-lang":       {"en", "ru"},
+	"style-guide":   {"netflix", "netflix-kids"},
+}
+
+// languageCachePath is where the last language lists fetched from the
+// providers are kept, so completing --lang needs no network.
+func languageCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vtt-translator", "languages.json"), nil
+}
+
+// rememberLanguages stores the codes of the configured provider for
+// completion. It is best effort: completion simply offers nothing without it.
+func rememberLanguages(langs []language) {
+	path, err := languageCachePath()
+	if err != nil {
+		return
+	}
+	cached := map[string][]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cached)
+	}
+	codes := map[string]bool{}
+	for _, l := range langs {
+		codes[l.Code] = true
+		for _, t := range l.Targets {
+			codes[t] = true
+		}
+	}
+	cached[providerName] = sortedKeys(codes)
+
+	data, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// cachedLanguages returns the codes of all providers seen so far.
+func cachedLanguages() []string {
+	path, err := languageCachePath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached map[string][]string
+	if json.Unmarshal(data, &cached) != nil {
+		return nil
+	}
+	codes := map[string]bool{}
+	for _, list := range cached {
+		for _, code := range list {
+			codes[code] = true
+		}
+	}
+	return sortedKeys(codes)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runCompletionCommand prints a completion script:
+// `completion bash|zsh|fish|powershell`. The scripts call back
+// `completion langs` for --lang and --source values, which prints the
+// language codes cached by `languages` and by translation runs.
+func runCompletionCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: completion bash|zsh|fish|powershell")
+	}
+	name := filepath.Base(os.Args[0])
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	var script string
+	switch args[0] {
+	case "langs":
+		for _, code := range cachedLanguages() {
+			fmt.Println(code)
+		}
+		return nil
+	case "bash":
+		script = bashCompletion(name)
+	case "zsh":
+		script = zshCompletion(name)
+	case "fish":
+		script = fishCompletion(name)
+	case "powershell":
+		script = powershellCompletion(name)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh, fish or powershell", args[0])
+	}
+	_, err := os.Stdout.WriteString(script)
+	return err
+}
+
+type completionFlag struct {
+	name   string
+	usage  string
+	isBool bool
+}
+
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{name: f.Name, usage: f.Usage, isBool: ok && b.IsBoolFlag()})
+	})
+	return flags
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func bashCompletion(name string) string {
+	fn := "_" + nonIdentifier.ReplaceAllString(name, "_")
+	var flagWords []string
+	for _, f := range completionFlags() {
+		flagWords = append(flagWords, "--"+f.name)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# bash completion for %s\n", name)
+	fmt.Fprintf(&sb, "%s() {\n", fn)
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	// Go flags take one or two dashes
+	sb.WriteString("    prev=\"${prev#-}\"\n    case \"${prev#-}\" in\n")
+	sb.WriteString("        lang|source)\n")
+	sb.WriteString("            local prefix=\"\"\n")
+	sb.WriteString("            [[ \"$cur\" == *,* ]] && prefix=\"${cur%,*},\"\n")
+	fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -P \"$prefix\" -W \"$(%s completion langs 2>/dev/null)\" -- \"${cur##*,}\"))\n", name)
+	sb.WriteString("            return ;;\n")
+	for _, f := range sortedFlagValues() {
+		files := ""
+		if slices.Contains(pathFlags, f) {
+			// Presets or a file, like --style-guide
+			files = ` $(compgen -f -- "$cur")`
+		}
+		fmt.Fprintf(&sb, "        %s)\n            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")%s)\n            return ;;\n", f, strings.Join(flagValues[f], " "), files)
+	}
+	fmt.Fprintf(&sb, "        %s)\n            COMPREPLY=($(compgen -f -- \"$cur\"))\n            return ;;\n", strings.Join(pathFlags, "|"))
+	sb.WriteString("    esac\n")
+	sb.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(flagWords, " "))
+	sb.WriteString("    else\n")
+	fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(commands, " "))
+	sb.WriteString("    fi\n")
+	sb.WriteString("}\n")
+	fmt.Fprintf(&sb, "complete -F %s %s\n", fn, name)
+	return sb.String()
+}
+
+func zshCompletion(name string) string {
+	fn := "_" + nonIdentifier.ReplaceAllString(name, "_")
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+	var flagSpecs []string
+	for _, f := range completionFlags() {
+		flagSpecs = append(flagSpecs, quote("--"+f.name+":"+strings.ReplaceAll(f.usage, ":", `\:`)))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#compdef %s\n\n", name)
+	fmt.Fprintf(&sb, "%s() {\n", fn)
+	fmt.Fprintf(&sb, "  local -a flags langs\n  flags=(\n    %s\n  )\n", strings.Join(flagSpecs, "\n    "))
+	sb.WriteString("  local prev=${words[CURRENT-1]#-}\n  case ${prev#-} in\n")
+	sb.WriteString("    lang|source)\n")
+	fmt.Fprintf(&sb, "      langs=(${(f)\"$(%s completion langs 2>/dev/null)\"})\n", name)
+	sb.WriteString("      compset -P '*,'\n")
+	sb.WriteString("      _describe 'language' langs\n      return ;;\n")
+	for _, f := range sortedFlagValues() {
+		files := ""
+		if slices.Contains(pathFlags, f) {
+			files = "\n      _files"
+		}
+		fmt.Fprintf(&sb, "    %s)\n      compadd %s%s\n      return ;;\n", f, strings.Join(flagValues[f], " "), files)
+	}
+	fmt.Fprintf(&sb, "    %s)\n      _files\n      return ;;\n", strings.Join(pathFlags, "|"))
+	sb.WriteString("  esac\n")
+	sb.WriteString("  if [[ ${words[CURRENT]} == -* ]]; then\n")
+	sb.WriteString("    _describe 'flag' flags\n")
+	sb.WriteString("  else\n")
+	fmt.Fprintf(&sb, "    compadd %s\n    _files\n", strings.Join(commands, " "))
+	sb.WriteString("  fi\n")
+	sb.WriteString("}\n\n")
+	fmt.Fprintf(&sb, "compdef %s %s\n", fn, name)
+	return sb.String()
+}
+
+func fishCompletion(name string) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# fish completion for %s\n", name)
+	fmt.Fprintf(&sb, "complete -c %s -f\n", name)
+	fmt.Fprintf(&sb, "complete -c %s -n __fish_use_subcommand -a %s\n", name, quote(strings.Join(commands, " ")))
+	for _, f := range completionFlags() {
+		line := fmt.Sprintf("complete -c %s -l %s -d %s", name, f.name, quote(f.usage))
+		switch {
+		case f.name == "lang" || f.name == "source":
+			line += fmt.Sprintf(" -x -a '(%s completion langs 2>/dev/null)'", name)
+		case flagValues[f.name] != nil && slices.Contains(pathFlags, f.name):
+			line += " -r -F -a " + quote(strings.Join(flagValues[f.name], " "))
+		case flagValues[f.name] != nil:
+			line += " -x -a " + quote(strings.Join(flagValues[f.name], " "))
+		case slices.Contains(pathFlags, f.name):
+			line += " -r -F"
+		case !f.isBool:
+			line += " -x"
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+func powershellCompletion(name string) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	// The unary comma keeps each pair from being flattened into $flags
+	var flagEntries, valueEntries []string
+	for _, f := range completionFlags() {
+		flagEntries = append(flagEntries, fmt.Sprintf("        ,@(%s, %s)", quote("--"+f.name), quote(f.usage)))
+	}
+	for _, f := range sortedFlagValues() {
+		var values []string
+		for _, v := range flagValues[f] {
+			values = append(values, quote(v))
+		}
+		valueEntries = append(valueEntries, fmt.Sprintf("        %s = @(%s)", quote(f), strings.Join(values, ", ")))
+	}
+	var commandList []string
+	for _, c := range commands {
+		commandList = append(commandList, quote(c))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# PowerShell completion for %s\n", name)
+	fmt.Fprintf(&sb, "Register-ArgumentCompleter -Native -CommandName %s, %s -ScriptBlock {\n", quote(name), quote(name+".exe"))
+	sb.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(&sb, "    $flags = @(\n%s\n    )\n", strings.Join(flagEntries, "\n"))
+	fmt.Fprintf(&sb, "    $values = @{\n%s\n    }\n", strings.Join(valueEntries, "\n"))
+	fmt.Fprintf(&sb, "    $commands = @(%s)\n", strings.Join(commandList, ", "))
+	sb.WriteString("    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+	sb.WriteString("    $prev = if ($wordToComplete) { $words[-2] } else { $words[-1] }\n")
+	sb.WriteString("    $prev = $prev -replace '^--?', ''\n")
+	sb.WriteString("    $candidates = $null\n")
+	sb.WriteString("    if ($prev -in @('lang', 'source')) {\n")
+	fmt.Fprintf(&sb, "        $candidates = @(& %s completion langs 2>$null)\n", quote(name))
+	sb.WriteString("    } elseif ($values.ContainsKey($prev)) {\n")
+	sb.WriteString("        $candidates = $values[$prev]\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("    if ($candidates) {\n")
+	sb.WriteString("        $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	sb.WriteString("            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	sb.WriteString("        }\n")
+	sb.WriteString("        return\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("    if ($wordToComplete -like '-*') {\n")
+	sb.WriteString("        $flags | Where-Object { $_[0] -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	sb.WriteString("            [System.Management.Automation.CompletionResult]::new($_[0], $_[0], 'ParameterName', $_[1])\n")
+	sb.WriteString("        }\n")
+	sb.WriteString("    } else {\n")
+	sb.WriteString("        $commands | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	sb.WriteString("            [System.Management.Automation.CompletionResult]::new($_, $_, 'Command', $_)\n")
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func sortedFlagValues() []string {
+	names := make([]string, 0, len(flagValues))
+	for name := range flagValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	conflictMu   sync.Mutex
+	overwriteAll bool
+	stdinReader  = bufio.NewReader(os.Stdin)
+)
+
+// isInteractive reports whether there is a terminal to ask on.
+var isInteractive = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// skipExistingOutput decides what happens to an output that already exists.
+// --force overwrites and --skip-existing skips without asking. Outputs
+// recorded in the state file are ours and are updated incrementally. For
+// other files an interactive terminal is asked, cp-style, and no answer
+// (end of input) means skip; without a terminal they are overwritten as
+// before.
+func skipExistingOutput(outputPath string) (bool, error) {
+	if _, err := os.Stat(outputPath); err != nil {
+		return false, nil
+	}
+	switch {
+	case forceOverwrite:
+		return false, nil
+	case skipExisting:
+		return true, nil
+	case statePath != "" && len(cueState.hashes(outputPath)) > 0:
+		return false, nil
+	case !isInteractive():
+		return false, nil
+	}
+
+	// One question at a time, files are processed in parallel
+	conflictMu.Lock()
+	defer conflictMu.Unlock()
+	if !overwriteAll {
+		_ = globalBar.Clear()
+		barOut.hold(true)
+		defer func() {
+			barOut.hold(false)
+			_ = globalBar.RenderBlank()
+		}()
+	}
+	for !overwriteAll {
+		statusf("\n❓ %s already exists: [o]verwrite, [s]kip, [r]ename the existing file, overwrite [a]ll? ", outputPath)
+		answer, err := stdinReader.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(answer) == "" {
+			statusln("")
+			return true, nil
+		}
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "o", "overwrite":
+			return false, nil
+		case "s", "skip":
+			return true, nil
+		case "r", "rename":
+			backup := backupName(outputPath)
+			if err := os.Rename(outputPath, backup); err != nil {
+				return false, err
+			}
+			statusf("📦 Renamed to %s\n", backup)
+			return false, nil
+		case "a", "all":
+			overwriteAll = true
+		}
+	}
+	return false, nil
+}
+
+// backupName returns a free name for moving an existing output aside:
+// example_ru.vtt.bak, then example_ru.vtt.bak2 and so on. The extension
+// keeps backups from being picked up as subtitles.
+func backupName(path string) string {
+	name := path + ".bak"
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s.bak%d", path, i)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// stubConflictPrompt makes skipExistingOutput read answers from input and
+// restores the globals it uses when the test ends.
+func stubConflictPrompt(t *testing.T, interactive bool, input string) {
+	oldReader, oldInteractive, oldOut, oldBar := stdinReader, isInteractive, statusOut, globalBar
+	oldForce, oldSkip, oldAll, oldState := forceOverwrite, skipExisting, overwriteAll, statePath
+	t.Cleanup(func() {
+		stdinReader, isInteractive, statusOut, globalBar = oldReader, oldInteractive, oldOut, oldBar
+		forceOverwrite, skipExisting, overwriteAll, statePath = oldForce, oldSkip, oldAll, oldState
+	})
+	stdinReader = bufio.NewReader(strings.NewReader(input))
+	isInteractive = func() bool { return interactive }
+	statusOut = io.Discard
+	globalBar = progressbar.NewOptions(1, progressbar.OptionSetWriter(io.Discard))
+	forceOverwrite, skipExisting, overwriteAll, statePath = false, false, false, ""
+}
+
+func TestSkipExistingOutputAnswers(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		skip    bool
+		renamed bool
+		all     bool
+	}{
+		{name: "overwrite", input: "o\n", skip: false},
+		{name: "overwrite, long form", input: " Overwrite \r\n", skip: false},
+		{name: "skip", input: "s\n", skip: true},
+		{name: "rename", input: "r\n", renamed: true},
+		{name: "overwrite all", input: "a\n", all: true},
+		{name: "asked again after an unknown answer", input: "what\n\ns\n", skip: true},
+		{name: "end of input skips", input: "", skip: true},
+		{name: "end of input after an unknown answer skips", input: "x\n", skip: true},
+		{name: "answer without a newline", input: "o", skip: false},
+		{name: "skip without a newline", input: "s", skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubConflictPrompt(t, true, tt.input)
+			output := filepath.Join(t.TempDir(), "e01_ru.vtt")
+			if err := os.WriteFile(output, []byte("WEBVTT\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			skip, err := skipExistingOutput(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if skip != tt.skip {
+				t.Errorf("skip = %v, want %v", skip, tt.skip)
+			}
+			_, err = os.Stat(output + ".bak")
+			if renamed := err == nil; renamed != tt.renamed {
+				t.Errorf("renamed = %v, want %v", renamed, tt.renamed)
+			}
+			if overwriteAll != tt.all {
+				t.Errorf("overwriteAll = %v, want %v", overwriteAll, tt.all)
+			}
+		})
+	}
+}
+
+func TestSkipExistingOutputWithoutPrompt(t *testing.T) {
+	tests := []struct {
+		name        string
+		missing     bool
+		force       bool
+		skipFlag    bool
+		recorded    bool
+		interactive bool
+		all         bool
+		skip        bool
+	}{
+		{name: "no output yet", missing: true, interactive: true},
+		{name: "--force", force: true, interactive: true},
+		{name: "--skip-existing", skipFlag: true, interactive: true, skip: true},
+		{name: "output of a previous run", recorded: true, interactive: true},
+		{name: "no terminal", interactive: false},
+		{name: "after overwrite all", all: true, interactive: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading the answer would fail the test: none of these may ask
+			stubConflictPrompt(t, tt.interactive, "")
+			stdinReader = bufio.NewReader(readerFunc(func([]byte) (int, error) {
+				t.Error("asked for an answer")
+				return 0, io.EOF
+			}))
+			forceOverwrite, skipExisting, overwriteAll = tt.force, tt.skipFlag, tt.all
+
+			output := filepath.Join(t.TempDir(), "e01_ru.vtt")
+			if !tt.missing {
+				if err := os.WriteFile(output, []byte("WEBVTT\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.recorded {
+				defer func(files map[string][]string) { cueState.Files = files }(cueState.Files)
+				cueState.Files = map[string][]string{}
+				cueState.record(output, []string{"hash"})
+				statePath = "translation_state.json"
+			}
+
+			skip, err := skipExistingOutput(output)
+			if err != nil || skip != tt.skip {
+				t.Errorf("skipExistingOutput() = %v, %v, want %v", skip, err, tt.skip)
+			}
+		})
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
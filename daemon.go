@@ -0,0 +1,637 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Job statuses; queued and running jobs are picked up again after a
+// restart, the others are history.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobOutputLines is how much of a job's status output is kept.
+const jobOutputLines = 20
+
+// job is one translation run of the daemon: an --input path into --lang.
+type job struct {
+	ID        int        `json:"id"`
+	Input     string     `json:"input"`
+	Lang      string     `json:"lang"`
+	OutputDir string     `json:"output_dir,omitempty"`
+	Status    string     `json:"status"`
+	ExitCode  int        `json:"exit_code"`
+	Output    []string   `json:"output,omitempty"`
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// jobStore is the durable queue: every change is written to a JSON file
+// before it takes effect, so jobs survive restarts and crashes. A JSON file
+// rather than SQLite keeps the build free of cgo and a database driver;
+// the history is capped at keep finished jobs, so rewriting the whole file
+// stays cheap.
+type jobStore struct {
+	mu     sync.Mutex
+	path   string
+	keep   int
+	Jobs   []*job `json:"jobs"`
+	NextID int    `json:"next_id"`
+
+	wake chan struct{}
+}
+
+func openJobStore(path string, keep int) (*jobStore, error) {
+	s := &jobStore{path: path, keep: keep, NextID: 1, wake: make(chan struct{}, 1)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	// Jobs that were running when the daemon stopped start over
+	for _, j := range s.Jobs {
+		if j.Status == jobRunning {
+			j.Status, j.Started = jobQueued, nil
+		}
+	}
+	return s, s.save()
+}
+
+// save writes the queue; callers hold s.mu.
+func (s *jobStore) save() error {
+	s.prune()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'), 0600)
+}
+
+// prune drops the oldest finished jobs beyond s.keep.
+func (s *jobStore) prune() {
+	finished := 0
+	for _, j := range s.Jobs {
+		if j.Finished != nil {
+			finished++
+		}
+	}
+	drop := finished - s.keep
+	if drop <= 0 {
+		return
+	}
+	s.Jobs = slices.DeleteFunc(s.Jobs, func(j *job) bool {
+		if j.Finished != nil && drop > 0 {
+			drop--
+			return true
+		}
+		return false
+	})
+}
+
+func (s *jobStore) add(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.ID, j.Status, j.Created = s.NextID, jobQueued, time.Now()
+	s.NextID++
+	s.Jobs = append(s.Jobs, j)
+	if err := s.save(); err != nil {
+		s.Jobs = s.Jobs[:len(s.Jobs)-1]
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func (s *jobStore) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next marks the oldest queued job running and returns a copy of it, or
+// nil if nothing is queued.
+func (s *jobStore) next() (*job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.Jobs {
+		if j.Status == jobQueued {
+			now := time.Now()
+			j.Status, j.Started = jobRunning, &now
+			copied := *j
+			return &copied, s.save()
+		}
+	}
+	return nil, nil
+}
+
+// update applies fn to a job and saves the queue.
+func (s *jobStore) update(id int, fn func(j *job) error) (*job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.Jobs {
+		if j.ID == id {
+			if err := fn(j); err != nil {
+				return nil, err
+			}
+			copied := *j
+			return &copied, s.save()
+		}
+	}
+	return nil, errJobNotFound
+}
+
+// get returns a copy of a job; reading does not touch the file.
+func (s *jobStore) get(id int) (*job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.Jobs {
+		if j.ID == id {
+			copied := *j
+			return &copied, nil
+		}
+	}
+	return nil, errJobNotFound
+}
+
+func (s *jobStore) list() []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]job, len(s.Jobs))
+	for i, j := range s.Jobs {
+		jobs[i] = *j
+	}
+	return jobs
+}
+
+var errJobNotFound = errors.New("job not found")
+
+// runDaemonCommand serves the job queue over HTTP and works through it:
+// `daemon [--listen addr] [--jobs file] [--parallel n] [--keep-jobs n]
+// [--roots dirs] [--token secret]`. Global flags given before `daemon` (provider, cache,
+// workers, ...) apply to every job.
+func runDaemonCommand(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8080", "Address of the REST API")
+	jobsPath := fs.String("jobs", "jobs.json", "File the job queue and history are kept in")
+	parallel := fs.Int("parallel", 1, "Number of jobs run at the same time")
+	keep := fs.Int("keep-jobs", 1000, "Number of finished jobs kept in the history")
+	rootList := fs.String("roots", ".", "Directories jobs may read from and write to, separated like PATH")
+	token := fs.String("token", "", "Bearer token the API requires, or a secret reference; needed unless --listen is a loopback address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *parallel <= 0 || *keep < 0 {
+		return errors.New("usage: daemon [--listen addr] [--jobs file] [--parallel n] [--keep-jobs n] [--roots dirs] [--token secret]")
+	}
+	secret, err := resolveSecret(*token)
+	if err != nil {
+		return fmt.Errorf("--token: %w", err)
+	}
+	if secret == "" && !isLoopback(*listen) {
+		return fmt.Errorf("--listen %s is reachable from other hosts, set --token", *listen)
+	}
+	var roots []string
+	for _, root := range filepath.SplitList(*rootList) {
+		if root == "" {
+			continue
+		}
+		abs, err := filepath.Abs(root)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			return fmt.Errorf("--roots: %w", err)
+		}
+		roots = append(roots, abs)
+	}
+	if len(roots) == 0 {
+		return errors.New("--roots lists no directories")
+	}
+
+	store, err := openJobStore(*jobsPath, *keep)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: *listen, Handler: requireToken(secret, jobsHandler(store, roots))}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	statusf("🛰️ Daemon listening on %s, jobs in %s\n", *listen, *jobsPath)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runJobs(ctx, store)
+		}()
+	}
+
+	select {
+	case err = <-serveErr:
+		stop()
+	case <-ctx.Done():
+		statusln("🛑 Stopping; running jobs will be resumed on the next start")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = server.Shutdown(shutdownCtx)
+		cancel()
+	}
+	wg.Wait()
+	return err
+}
+
+// runJobs takes queued jobs one at a time until ctx is done.
+func runJobs(ctx context.Context, store *jobStore) {
+	for ctx.Err() == nil {
+		j, err := store.next()
+		if err != nil {
+			logError(fmt.Sprintf("Job queue error: %v", err))
+		}
+		if j == nil {
+			select {
+			case <-store.wake:
+			case <-ctx.Done():
+			case <-time.After(time.Minute):
+			}
+			continue
+		}
+
+		statusf("▶️ Job %d: %s → %s\n", j.ID, j.Input, j.Lang)
+		code, output := runJob(ctx, j)
+		final, err := store.update(j.ID, func(j *job) error {
+			now := time.Now()
+			j.ExitCode, j.Output, j.Finished = code, output, &now
+			switch {
+			case ctx.Err() != nil:
+				// Interrupted by the shutdown, not failed: run it again
+				j.Status, j.Started, j.Finished = jobQueued, nil, nil
+			case code == exitOK:
+				j.Status = jobDone
+			default:
+				j.Status = jobFailed
+			}
+			return nil
+		})
+		if err != nil {
+			logError(fmt.Sprintf("Job queue error: %v", err))
+			continue
+		}
+		if final.Finished != nil {
+			statusf("⏹️ Job %d: %s (exit code %d)\n", final.ID, final.Status, final.ExitCode)
+		}
+		// Let the others pick up jobs queued meanwhile
+		store.notify()
+	}
+}
+
+// runJob runs the job as a child process with the daemon's global flags
+// and returns its exit code and the last lines of its status output.
+func runJob(ctx context.Context, j *job) (int, []string) {
+	self, err := os.Executable()
+	if err != nil {
+		return exitSetupError, []string{err.Error()}
+	}
+	files, err := startJobFiles(j.ID)
+	if err != nil {
+		return exitSetupError, []string{err.Error()}
+	}
+	args := append(jobArgs(os.Args[1:len(os.Args)-flag.NArg()]),
+		"--input", j.Input, "--lang", j.Lang, "--no-color", "--cache", files.cache, "--state", files.state)
+	if j.OutputDir != "" {
+		args = append(args, "--output-dir", j.OutputDir)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, self, args...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	if mergeErr := files.finish(); mergeErr != nil {
+		logError(fmt.Sprintf("Job %d: %v", j.ID, mergeErr))
+	}
+	code := exitOK
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return exitSetupError, []string{err.Error()}
+	}
+	return code, lastLines(output.String(), jobOutputLines)
+}
+
+// jobOwnFlags are global flags not passed on to jobs: --pprof is bound by
+// the daemon, the others are set per job.
+var jobOwnFlags = []string{"pprof", "input", "input-list", "lang", "output-dir", "cache", "state"}
+
+// jobArgs filters the daemon's global flags for a job. It works on the
+// command line rather than on parsed values, so secret references stay
+// references instead of showing up resolved in the job's arguments.
+func jobArgs(args []string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		n := 1
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if f := flag.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+			n = min(2, len(args)-i)
+		}
+		if !slices.Contains(jobOwnFlags, name) {
+			kept = append(kept, args[i:i+n]...)
+		}
+		i += n - 1
+	}
+	return kept
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// jobFilesMu serializes copying the shared cache and state files for a job
+// and merging them back.
+var jobFilesMu sync.Mutex
+
+// jobFiles are a job's own copies of --cache and --state. Jobs running side
+// by side would otherwise each rewrite the shared files with what they
+// loaded at start, dropping what the others added.
+type jobFiles struct {
+	cache, state string // empty when disabled
+	stateBefore  map[string][]string
+}
+
+func startJobFiles(id int) (*jobFiles, error) {
+	jobFilesMu.Lock()
+	defer jobFilesMu.Unlock()
+	files := &jobFiles{}
+	if cachePath != "" {
+		files.cache = fmt.Sprintf("%s.job%d", cachePath, id)
+		entries, err := readCacheFile(cachePath)
+		if errors.Is(err, os.ErrNotExist) {
+			entries, err = cacheEntries{}, nil
+		}
+		if err == nil {
+			err = writeCacheFile(files.cache, entries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("copy cache: %w", err)
+		}
+	}
+	if statePath != "" {
+		files.state = fmt.Sprintf("%s.job%d", statePath, id)
+		before, err := readStateFile(statePath)
+		if err == nil {
+			files.stateBefore = before
+			err = writeStateFile(files.state, before)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("copy state: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// finish merges the job's copies back: new cache entries are added, and
+// only the state entries the job changed replace the shared ones.
+func (f *jobFiles) finish() error {
+	jobFilesMu.Lock()
+	defer jobFilesMu.Unlock()
+	var errs []error
+	if f.cache != "" {
+		errs = append(errs, mergeJobCache(f.cache))
+		_ = os.Remove(f.cache)
+	}
+	if f.state != "" {
+		errs = append(errs, mergeJobState(f.state, f.stateBefore))
+		_ = os.Remove(f.state)
+	}
+	return errors.Join(errs...)
+}
+
+func mergeJobCache(path string) error {
+	added, err := readCacheFile(path)
+	if err != nil {
+		return fmt.Errorf("merge cache: %w", err)
+	}
+	entries, err := readCacheFile(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		entries, err = cacheEntries{}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("merge cache: %w", err)
+	}
+	entries.merge(added)
+	return writeCacheFile(cachePath, entries)
+}
+
+func mergeJobState(path string, before map[string][]string) error {
+	after, err := readStateFile(path)
+	if err != nil {
+		return fmt.Errorf("merge state: %w", err)
+	}
+	files, err := readStateFile(statePath)
+	if err != nil {
+		return fmt.Errorf("merge state: %w", err)
+	}
+	for output, hashes := range after {
+		if !slices.Equal(before[output], hashes) {
+			files[output] = hashes
+		}
+	}
+	return writeStateFile(statePath, files)
+}
+
+// lastLines keeps the last n non-empty lines of status output, reducing
+// progress bar redraws to their final state.
+func lastLines(text string, n int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		if line = strings.TrimRight(line, " \r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines[max(0, len(lines)-n):]
+}
+
+// jobsHandler is the REST API of the daemon:
+//
+//	POST   /jobs       {"input": "/data/lectures", "lang": "ru", "output_dir": "/data/out"}
+//	GET    /jobs       all jobs, oldest first
+//	GET    /jobs/{id}  one job
+//	DELETE /jobs/{id}  cancel a queued job
+func jobsHandler(store *jobStore, roots []string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var j job
+		if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		langs := parseLangs(j.Lang)
+		if j.Input == "" || len(langs) == 0 {
+			http.Error(w, "input and lang are required", http.StatusBadRequest)
+			return
+		}
+		// lang names output directories, so it must not hold a path
+		if err := checkLangCodes(langs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		input, err := jobPath(j.Input, roots)
+		if err == nil {
+			_, err = os.Stat(input)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		output := ""
+		if j.OutputDir != "" {
+			if output, err = jobPath(j.OutputDir, roots); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		created := job{Input: input, Lang: strings.Join(langs, ","), OutputDir: output}
+		if err := store.add(&created); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, store.list())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serveJob(w, r, store.get)
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serveJob(w, r, func(id int) (*job, error) {
+			return store.update(id, func(j *job) error {
+				if j.Status != jobQueued {
+					return fmt.Errorf("job %d is %s, only queued jobs can be canceled", j.ID, j.Status)
+				}
+				now := time.Now()
+				j.Status, j.Finished = jobCanceled, &now
+				return nil
+			})
+		})
+	})
+	return mux
+}
+
+// jobPath resolves a path of a job request, following symlinks as far as
+// the path exists, and refuses it unless it lies within one of roots.
+func jobPath(path string, roots []string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s: the daemon needs absolute paths", path)
+	}
+	resolved := filepath.Clean(path)
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(resolved)
+		if err == nil {
+			resolved = filepath.Join(append([]string{real}, rest...)...)
+			break
+		}
+		parent := filepath.Dir(resolved)
+		if parent == resolved {
+			break
+		}
+		rest = append([]string{filepath.Base(resolved)}, rest...)
+		resolved = parent
+	}
+	for _, root := range roots {
+		if isWithin(resolved, root) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the daemon's --roots", path)
+}
+
+// isLoopback reports whether a listen address only accepts local
+// connections; an empty host listens on all interfaces.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireToken rejects requests without "Authorization: Bearer <token>";
+// an empty token leaves the API open.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serveJob(w http.ResponseWriter, r *http.Request, fn func(id int) (*job, error)) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	j, err := fn(id)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logError(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
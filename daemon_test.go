@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tempRoot is a temporary directory with symlinks resolved, as the daemon
+// keeps its --roots.
+func tempRoot(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestJobPath(t *testing.T) {
+	base := tempRoot(t)
+	root := filepath.Join(base, "media")
+	outside := filepath.Join(base, "private")
+	for _, dir := range []string{filepath.Join(root, "show"), outside, root + "-extras"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skip("symlinks not available:", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "show"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string // empty: refused
+	}{
+		{"file in a root", filepath.Join(root, "show", "e01.vtt"), filepath.Join(root, "show", "e01.vtt")},
+		{"the root itself", root, root},
+		{"missing tail", filepath.Join(root, "out", "ru", "new"), filepath.Join(root, "out", "ru", "new")},
+		{"symlink within the root", filepath.Join(root, "alias", "e01.vtt"), filepath.Join(root, "show", "e01.vtt")},
+		{"missing tail below a symlink", filepath.Join(root, "alias", "ru", "x"), filepath.Join(root, "show", "ru", "x")},
+		{"symlink out of the root", filepath.Join(root, "escape", "keys"), ""},
+		{"missing tail below an escaping symlink", filepath.Join(root, "escape", "new", "x"), ""},
+		{"dot-dot out of the root", filepath.Join(root, "show") + "/../../private/keys", ""},
+		{"dot-dot staying inside", filepath.Join(root, "show") + "/../show/e01.vtt", filepath.Join(root, "show", "e01.vtt")},
+		{"sibling sharing the prefix", filepath.Join(root+"-extras", "e01.vtt"), ""},
+		{"relative path", "media/show/e01.vtt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jobPath(filepath.FromSlash(tt.path), []string{root})
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("jobPath(%q) = %q, want it refused", tt.path, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("jobPath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"localhost:8080", true},
+		{"localhost:1", true},
+		{"127.0.0.1:8080", true},
+		{"127.1.2.3:1", true},
+		{"[::1]:1", true},
+		{":8080", false},
+		{"0.0.0.0:1", false},
+		{"[::]:1", false},
+		{"192.168.1.10:8080", false},
+		{"example.com:80", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestJobArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "flag value as the next argument",
+			args: []string{"--provider", "ollama", "-workers", "3"},
+			want: []string{"--provider", "ollama", "-workers", "3"},
+		},
+		{
+			name: "flag=value",
+			args: []string{"--provider=ollama", "--translate-notes=false"},
+			want: []string{"--provider=ollama", "--translate-notes=false"},
+		},
+		{
+			name: "bool flags take no value",
+			args: []string{"--force", "--workers", "2", "-no-color"},
+			want: []string{"--force", "--workers", "2", "-no-color"},
+		},
+		{
+			name: "secret references stay unresolved",
+			args: []string{"--llm-key", "env:OPENAI_KEY"},
+			want: []string{"--llm-key", "env:OPENAI_KEY"},
+		},
+		{
+			name: "flags set per job are dropped with their values",
+			args: []string{"--cache", "shared.json", "--lang", "ru", "--workers", "2", "--state=s.json", "--input", "/in", "--input-list=l.txt", "--output-dir", "/out"},
+			want: []string{"--workers", "2"},
+		},
+		{
+			name: "pprof is dropped",
+			args: []string{"--pprof", ":6060", "--force"},
+			want: []string{"--force"},
+		},
+		{
+			name: "value flag at the end",
+			args: []string{"--force", "--workers"},
+			want: []string{"--force", "--workers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobArgs(tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("jobArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenJobStore(t *testing.T) {
+	now := time.Now()
+	queue := &jobStore{NextID: 6, Jobs: []*job{
+		{ID: 1, Status: jobDone, Started: &now, Finished: &now},
+		{ID: 2, Status: jobRunning, Started: &now},
+		{ID: 3, Status: jobFailed, Started: &now, Finished: &now},
+		{ID: 4, Status: jobQueued},
+		{ID: 5, Status: jobCanceled, Finished: &now},
+	}}
+	data, err := json.Marshal(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keep int
+		ids  []int
+	}{
+		{keep: 1000, ids: []int{1, 2, 3, 4, 5}},
+		{keep: 2, ids: []int{2, 3, 4, 5}},
+		{keep: 0, ids: []int{2, 4}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "jobs.json")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		store, err := openJobStore(path, tt.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// What was written must read back the same
+		reopened, err := openJobStore(path, tt.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []*jobStore{store, reopened} {
+			var ids []int
+			for _, j := range s.Jobs {
+				ids = append(ids, j.ID)
+				if j.ID == 2 && (j.Status != jobQueued || j.Started != nil) {
+					t.Errorf("keep %d: interrupted job is %s, started %v; want it queued again", tt.keep, j.Status, j.Started)
+				}
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("keep %d: jobs %v, want %v", tt.keep, ids, tt.ids)
+			}
+			if s.NextID != 6 {
+				t.Errorf("keep %d: next id %d, want 6", tt.keep, s.NextID)
+			}
+		}
+	}
+
+	store, err := openJobStore(filepath.Join(t.TempDir(), "missing.json"), 10)
+	if err != nil || len(store.Jobs) != 0 || store.NextID != 1 {
+		t.Errorf("openJobStore(missing) = %+v, %v, want an empty queue", store, err)
+	}
+}
+
+func TestMergeJobState(t *testing.T) {
+	defer func(path string) { statePath = path }(statePath)
+	dir := t.TempDir()
+	statePath = filepath.Join(dir, "state.json")
+	jobState := filepath.Join(dir, "state.json.job1")
+
+	// The job started from a and b; meanwhile another job changed b and added c
+	before := map[string][]string{"a": {"a1"}, "b": {"b1"}}
+	shared := map[string][]string{"a": {"a1"}, "b": {"b2"}, "c": {"c1"}}
+	after := map[string][]string{"a": {"a2"}, "b": {"b1"}, "d": {"d1"}}
+	if err := writeStateFile(statePath, shared); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStateFile(jobState, after); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mergeJobState(jobState, before); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readStateFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": {"a2"}, "b": {"b2"}, "c": {"c1"}, "d": {"d1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged state = %v, want %v", got, want)
+	}
+}
+
+func TestJobsHandlerAdd(t *testing.T) {
+	root := tempRoot(t)
+	input := filepath.Join(root, "e01.vtt")
+	if err := os.WriteFile(input, []byte("WEBVTT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.json"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := jobsHandler(store, []string{root})
+
+	tests := []struct {
+		name     string
+		request  job
+		code     int
+		wantLang string
+	}{
+		{"one language", job{Input: input, Lang: "ru"}, http.StatusCreated, "ru"},
+		{"language list", job{Input: input, Lang: " ru, pt-BR ,"}, http.StatusCreated, "ru,pt-BR"},
+		{"output dir in a root", job{Input: input, Lang: "de", OutputDir: filepath.Join(root, "out")}, http.StatusCreated, "de"},
+		{"no language", job{Input: input, Lang: " , "}, http.StatusBadRequest, ""},
+		{"path as language", job{Input: input, Lang: "../../../tmp/x", OutputDir: filepath.Join(root, "out")}, http.StatusBadRequest, ""},
+		{"separator in language", job{Input: input, Lang: `ru\..\..`}, http.StatusBadRequest, ""},
+		{"input outside the roots", job{Input: filepath.Dir(root), Lang: "ru"}, http.StatusBadRequest, ""},
+		{"missing input", job{Input: filepath.Join(root, "missing.vtt"), Lang: "ru"}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/jobs", strings.NewReader(string(body))))
+			if rec.Code != tt.code {
+				t.Fatalf("status %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.code)
+			}
+			if tt.code != http.StatusCreated {
+				return
+			}
+			var created job
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+				t.Fatal(err)
+			}
+			if created.Lang != tt.wantLang || created.Status != jobQueued {
+				t.Errorf("created job %+v, want lang %q and queued", created, tt.wantLang)
+			}
+		})
+	}
+}
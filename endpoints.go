@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// endpoint is one LibreTranslate instance of an --endpoints config file.
+type endpoint struct {
+	URL            string   `json:"url"`
+	Weight         int      `json:"weight"`
+	MaxConcurrency int      `json:"max_concurrency"`
+	APIKey         string   `json:"api_key"`
+	Languages      []string `json:"languages"`
+
+	inflight int
+	sent     int
+}
+
+// serves reports whether the instance has both languages loaded; an
+// endpoint without a language list serves every pair.
+func (e *endpoint) serves(source, target string) bool {
+	return len(e.Languages) == 0 || slices.Contains(e.Languages, source) && slices.Contains(e.Languages, target)
+}
+
+// endpointPool spreads requests over several instances in proportion to
+// their weights, within their concurrency limits and language lists.
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	released  chan struct{} // closed and replaced whenever a slot frees up
+}
+
+// loadEndpoints reads an --endpoints config file:
+//
+//	{"endpoints": [{"url": "http://gpu1:5000/translate", "weight": 3, "max_concurrency": 8},
+//	               {"url": "http://cpu:5000/translate", "api_key": "keyring:cpu", "languages": ["en", "ru"]}]}
+func loadEndpoints(path string) (*endpointPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Endpoints []*endpoint `json:"endpoints"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(config.Endpoints) == 0 {
+		return nil, fmt.Errorf("%s lists no endpoints", path)
+	}
+	for i, e := range config.Endpoints {
+		if e.URL == "" {
+			return nil, fmt.Errorf("%s: endpoint %d has no url", path, i+1)
+		}
+		if e.Weight < 0 || e.MaxConcurrency < 0 {
+			return nil, fmt.Errorf("%s: %s: weight and max_concurrency must not be negative", path, e.URL)
+		}
+		if e.Weight == 0 {
+			e.Weight = 1
+		}
+		if e.APIKey, err = resolveSecret(e.APIKey); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, e.URL, err)
+		}
+	}
+	return &endpointPool{endpoints: config.Endpoints, released: make(chan struct{})}, nil
+}
+
+func (p *endpointPool) serves(source, target string) bool {
+	return slices.ContainsFunc(p.endpoints, func(e *endpoint) bool { return e.serves(source, target) })
+}
+
+// acquire waits for a free slot on an endpoint serving the language pair
+// and takes the one that was sent the fewest requests per unit of weight.
+func (p *endpointPool) acquire(source, target string) (*endpoint, error) {
+	for {
+		p.mu.Lock()
+		var best *endpoint
+		serving := false
+		for _, e := range p.endpoints {
+			if !e.serves(source, target) {
+				continue
+			}
+			serving = true
+			if e.MaxConcurrency > 0 && e.inflight >= e.MaxConcurrency {
+				continue
+			}
+			// sent/weight < best.sent/best.weight without division
+			if best == nil || e.sent*best.Weight < best.sent*e.Weight {
+				best = e
+			}
+		}
+		if best != nil {
+			best.inflight++
+			best.sent++
+			p.mu.Unlock()
+			return best, nil
+		}
+		released := p.released
+		p.mu.Unlock()
+		if !serving {
+			return nil, fmt.Errorf("no endpoint serves %s → %s", source, target)
+		}
+
+		select {
+		case <-released:
+		case <-runCtx.Done():
+			return nil, runCtx.Err()
+		}
+	}
+}
+
+func (p *endpointPool) release(e *endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.inflight--
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// languages merges the language lists of all endpoints, keeping the
+// targets each language is served with. It fails only if every
+// endpoint does.
+func (p *endpointPool) languages() ([]language, error) {
+	var langs []language
+	index := map[string]int{}
+	var errs []error
+	for _, e := range p.endpoints {
+		list, err := libreTranslateLanguages(e.URL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.URL, err))
+			continue
+		}
+		for _, l := range list {
+			i, ok := index[l.Code]
+			if !ok {
+				index[l.Code] = len(langs)
+				langs = append(langs, l)
+				continue
+			}
+			for _, t := range l.Targets {
+				if !slices.Contains(langs[i].Targets, t) {
+					langs[i].Targets = append(langs[i].Targets, t)
+				}
+			}
+		}
+	}
+	if len(langs) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return langs, nil
+}
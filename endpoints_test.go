@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolWeights(t *testing.T) {
+	pool := &endpointPool{released: make(chan struct{}), endpoints: []*endpoint{
+		{URL: "gpu", Weight: 3},
+		{URL: "cpu", Weight: 1},
+		{URL: "ru-only", Weight: 5, Languages: []string{"en", "ru"}},
+	}}
+	counts := map[string]int{}
+	for range 40 {
+		e, err := pool.acquire("en", "de")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[e.URL]++
+		pool.release(e)
+	}
+	if counts["gpu"] != 30 || counts["cpu"] != 10 || counts["ru-only"] != 0 {
+		t.Errorf("requests per endpoint = %v, want gpu:30 cpu:10", counts)
+	}
+
+	counts = map[string]int{}
+	for range 9 {
+		e, err := pool.acquire("en", "ru")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[e.URL]++
+		pool.release(e)
+	}
+	// The first two endpoints were already sent 40 requests
+	if counts["ru-only"] != 9 {
+		t.Errorf("requests per endpoint = %v, want ru-only:9", counts)
+	}
+
+	if _, err := pool.acquire("en", "ja"); err != nil {
+		t.Errorf("acquire(en, ja) = %v, want an endpoint without a language list", err)
+	}
+}
+
+func TestEndpointPoolConcurrency(t *testing.T) {
+	pool := &endpointPool{released: make(chan struct{}), endpoints: []*endpoint{
+		{URL: "small", Weight: 10, MaxConcurrency: 1},
+		{URL: "big", Weight: 1, MaxConcurrency: 2},
+	}}
+	var held []*endpoint
+	for range 3 {
+		e, err := pool.acquire("en", "ru")
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, e)
+	}
+	if held[0].URL != "small" || held[1].URL != "big" || held[2].URL != "big" {
+		t.Fatalf("acquired %s, %s, %s; want small, big, big", held[0].URL, held[1].URL, held[2].URL)
+	}
+
+	// Every slot is taken: the next request waits for a release
+	got := make(chan *endpoint)
+	go func() {
+		e, _ := pool.acquire("en", "ru")
+		got <- e
+	}()
+	select {
+	case e := <-got:
+		t.Fatalf("acquired %s beyond max_concurrency", e.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.release(held[0])
+	select {
+	case e := <-got:
+		if e.URL != "small" {
+			t.Errorf("acquired %s after small was released", e.URL)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not wake up after a release")
+	}
+}
+
+func TestEndpointPoolUnserved(t *testing.T) {
+	pool := &endpointPool{released: make(chan struct{}), endpoints: []*endpoint{
+		{URL: "a", Weight: 1, Languages: []string{"en", "ru"}},
+	}}
+	if pool.serves("en", "de") {
+		t.Error("serves(en, de) = true")
+	}
+	if _, err := pool.acquire("en", "de"); err == nil {
+		t.Error("acquire(en, de) succeeded, want an error")
+	}
+}
+
+// TestEndpointPoolAbort checks that a request waiting for a slot gives up
+// when the run is aborted.
+func TestEndpointPoolAbort(t *testing.T) {
+	defer func(ctx context.Context, cancel context.CancelCauseFunc) {
+		runCtx, abortRun = ctx, cancel
+	}(runCtx, abortRun)
+	runCtx, abortRun = context.WithCancelCause(context.Background())
+
+	pool := &endpointPool{released: make(chan struct{}), endpoints: []*endpoint{
+		{URL: "a", Weight: 1, MaxConcurrency: 1},
+	}}
+	if _, err := pool.acquire("en", "ru"); err != nil {
+		t.Fatal(err)
+	}
+	abortRun(context.Canceled)
+	if _, err := pool.acquire("en", "ru"); err == nil {
+		t.Error("acquire succeeded after the run was aborted")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place once it is completely on disk, so a crash or a full disk
+// never leaves a truncated file that looks finished.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// CreateTemp uses 0600
+	if err := os.Chmod(tmp, perm); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// preserveAttributes copies the --preserve attributes other than the mode,
+// which is set when writing, from the source file to an output. Each one
+// is applied even if another fails.
+func preserveAttributes(source os.FileInfo, path string) error {
+	var errs []error
+	if preserve["owner"] {
+		errs = append(errs, chownLike(source, path))
+	}
+	if preserve["mtime"] {
+		errs = append(errs, os.Chtimes(path, time.Time{}, source.ModTime()))
+	}
+	return errors.Join(errs...)
+}
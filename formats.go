@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subtitle formats, named after their usual file extension.
+const (
+	formatVTT      = "vtt"
+	formatSRT      = "srt"
+	formatMicroDVD = "sub"
+)
+
+// defaultFPS is assumed for MicroDVD files that do not declare a frame rate.
+const defaultFPS = 23.976
+
+var (
+	microDVDLine = regexp.MustCompile(`^\{(\d+)\}\{(\d*)\}(.*)$`)
+	microDVDCode = regexp.MustCompile(`^\{([a-zA-Z]):([^}]*)\}`)
+)
+
+func subtitleFormat(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// readSubtitle reads and parses a subtitle file according to its extension
+// and also returns its number of lines. fps only matters for MicroDVD.
+func readSubtitle(path string, fps float64) (*subtitle, int, error) {
+	if isCaptionDocument(path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		doc, err := parseCaptionDocument(subtitleFormat(path), data)
+		if err != nil {
+			return nil, 0, err
+		}
+		return doc, doc.lineCount(), nil
+	}
+	if subtitleFormat(path) == formatMicroDVD && isVobSub(path) {
+		return nil, 0, fmt.Errorf("%w: VobSub image subtitles", errNotCaptions)
+	}
+	lines, newline, err := readLines(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if subtitleFormat(path) == formatMicroDVD {
+		doc, err := parseMicroDVD(lines, newline, fps)
+		return doc, len(lines), err
+	}
+	return parseSubtitle(lines, newline), len(lines), nil
+}
+
+// vobSubHeader starts an MPEG-2 program stream, which is what VobSub .sub
+// files next to their .idx are.
+var vobSubHeader = []byte{0x00, 0x00, 0x01, 0xba}
+
+// isVobSub reports whether a .sub file holds VobSub images rather than
+// MicroDVD text.
+func isVobSub(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(vobSubHeader))
+	_, err = io.ReadFull(f, header)
+	return err == nil && bytes.Equal(header, vobSubHeader)
+}
+
+// parseMicroDVD reads frame-timed "{start}{end}line|line" subtitles. fps is
+// used unless the file declares its own rate in a leading "{1}{1}25" cue.
+func parseMicroDVD(lines []string, newline string, fps float64) (*subtitle, error) {
+	doc := &subtitle{newline: newline}
+	fromFile, declaredFPS := fps <= 0, false
+	if fromFile {
+		fps = defaultFPS
+	}
+
+	for i, line := range lines {
+		if i == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := microDVDLine.FindStringSubmatch(line)
+		if m == nil && len(doc.blocks) == 0 && !declaredFPS {
+			// Another .sub format, such as SubViewer
+			return nil, fmt.Errorf("%w: line %d is not a MicroDVD cue: %.40q", errNotCaptions, i+1, line)
+		}
+		if m == nil {
+			return nil, fmt.Errorf("line %d is not a MicroDVD cue: %q", i+1, line)
+		}
+		if len(doc.blocks) == 0 && (m[1] == "0" || m[1] == "1") && (m[2] == "0" || m[2] == "1") {
+			if declared, err := strconv.ParseFloat(strings.TrimSpace(m[3]), 64); err == nil && declared > 0 {
+				declaredFPS = true
+				if fromFile {
+					fps = declared
+				}
+				continue
+			}
+		}
+
+		startFrame, _ := strconv.Atoi(m[1])
+		start := framesToDuration(startFrame, fps)
+		end := start + 2*time.Second
+		if m[2] != "" {
+			endFrame, _ := strconv.Atoi(m[2])
+			end = framesToDuration(endFrame, fps)
+		}
+
+		t := cueTiming{start: start, end: end}
+		doc.blocks = append(doc.blocks, &block{
+			kind:   blockCue,
+			id:     strconv.Itoa(len(doc.blocks) + 1),
+			timing: t.String(),
+			times:  t,
+			lines:  microDVDText(m[3]),
+			lineNo: i + 1,
+		})
+	}
+	doc.fps = fps
+	return doc, nil
+}
+
+func framesToDuration(frames int, fps float64) time.Duration {
+	return time.Duration(float64(frames) / fps * float64(time.Second))
+}
+
+// microDVDText splits a cue on "|" and turns the italic/bold/underline
+// control codes into tags; other codes (colour, font, size) are dropped.
+// Upper-case codes apply to every line of the cue, lower-case to one line.
+func microDVDText(text string) []string {
+	var cueTags []string
+	var lines []string
+	for _, part := range strings.Split(text, "|") {
+		lineTags := append([]string(nil), cueTags...)
+		for {
+			m := microDVDCode.FindStringSubmatch(part)
+			if m == nil {
+				break
+			}
+			part = part[len(m[0]):]
+			if !strings.EqualFold(m[1], "y") {
+				continue
+			}
+			for _, style := range strings.Split(strings.ToLower(m[2]), ",") {
+				if style != "i" && style != "b" && style != "u" {
+					continue
+				}
+				lineTags = append(lineTags, style)
+				if m[1] == "Y" {
+					cueTags = append(cueTags, style)
+				}
+			}
+		}
+		for i := len(lineTags) - 1; i >= 0; i-- {
+			part = "<" + lineTags[i] + ">" + part + "</" + lineTags[i] + ">"
+		}
+		lines = append(lines, part)
+	}
+	return lines
+}
+
+// convertTo rewrites the document so it renders in the given format. SRT has
+// no header, comments, styles or regions, so those blocks are dropped and
+// cues are renumbered; cue settings are dropped as well.
+func (s *subtitle) convertTo(format string) {
+	s.captions = nil
+	switch format {
+	case formatSRT:
+		var cues []*block
+		for _, cue := range s.cues() {
+			cue.id = strconv.Itoa(len(cues) + 1)
+			cue.times.comma, cue.times.short, cue.times.settings = true, false, ""
+			cue.timing = cue.times.String()
+			cues = append(cues, cue)
+		}
+		s.blocks = cues
+	case formatVTT:
+		for _, cue := range s.cues() {
+			if cue.times.comma {
+				cue.times.comma = false
+				cue.timing = cue.times.String()
+			}
+		}
+		if len(s.blocks) == 0 || s.blocks[0].kind != blockHeader {
+			header := &block{kind: blockHeader, lines: []string{"WEBVTT"}}
+			s.blocks = append([]*block{header}, s.blocks...)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseMicroDVD(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		fps     float64
+		wantFPS float64
+		times   []cueTiming
+		lines   [][]string
+	}{
+		{
+			name:    "declared rate",
+			text:    "{1}{1}25\n{25}{50}Hello|world\n{75}{}{y:i}Slanted\n",
+			wantFPS: 25,
+			times:   []cueTiming{{start: time.Second, end: 2 * time.Second}, {start: 3 * time.Second, end: 5 * time.Second}},
+			lines:   [][]string{{"Hello", "world"}, {"<i>Slanted</i>"}},
+		},
+		{
+			name:    "--fps wins over the file",
+			text:    "{1}{1}25\n{10}{20}Ten\n",
+			fps:     10,
+			wantFPS: 10,
+			times:   []cueTiming{{start: time.Second, end: 2 * time.Second}},
+			lines:   [][]string{{"Ten"}},
+		},
+		{
+			name:    "cue-wide style",
+			text:    "{0}{24}{Y:b}One|Two\n",
+			fps:     24,
+			wantFPS: 24,
+			times:   []cueTiming{{start: 0, end: time.Second}},
+			lines:   [][]string{{"<b>One</b>", "<b>Two</b>"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, newline := splitLines(tt.text)
+			doc, err := parseMicroDVD(lines, newline, tt.fps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.fps != tt.wantFPS {
+				t.Errorf("fps = %v, want %v", doc.fps, tt.wantFPS)
+			}
+			cues := doc.cues()
+			if len(cues) != len(tt.times) {
+				t.Fatalf("got %d cues, want %d", len(cues), len(tt.times))
+			}
+			for i, cue := range cues {
+				if cue.times.start != tt.times[i].start || cue.times.end != tt.times[i].end {
+					t.Errorf("cue %d times = %v-%v, want %v-%v", i, cue.times.start, cue.times.end, tt.times[i].start, tt.times[i].end)
+				}
+				if !slices.Equal(cue.lines, tt.lines[i]) {
+					t.Errorf("cue %d lines = %q, want %q", i, cue.lines, tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMicroDVDErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		notCaptions bool
+	}{
+		{"subviewer", "[INFORMATION]\n[TITLE]x\n00:00:01.00,00:00:02.00\nHello\n", true},
+		{"broken cue", "{1}{25}Hello\nnot a cue\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, newline := splitLines(tt.text)
+			_, err := parseMicroDVD(lines, newline, 25)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if got := errors.Is(err, errNotCaptions); got != tt.notCaptions {
+				t.Errorf("errors.Is(%v, errNotCaptions) = %v, want %v", err, got, tt.notCaptions)
+			}
+		})
+	}
+}
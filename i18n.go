@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// uiLang is the language of CLI messages and the summary, from --ui-lang
+// or the locale. Messages without a translation stay in English, as do the
+// error log and error details.
+var uiLang = "en"
+
+// uiMessages translates message formats, keyed by the English format
+// passed to statusf, statusln or tr. Counts are put after a colon, which
+// avoids plural forms.
+var uiMessages = map[string]map[string]string{
+	"ru": {
+		"Please specify path with --input and language with --lang":             "Укажите путь в --input и язык в --lang",
+		"Invalid --input path: %v\n":                                            "Неверный путь --input: %v\n",
+		"Invalid --output-dir path: %v\n":                                       "Неверный путь --output-dir: %v\n",
+		"Please specify at least one target language with --lang":               "Укажите хотя бы один язык перевода в --lang",
+		"Invalid --chapters value %q, expected auto, on or off\n":               "Неверное значение --chapters %q, ожидается auto, on или off\n",
+		"Invalid --scale value %v, must be positive\n":                          "Неверное значение --scale %v, должно быть положительным\n",
+		"Invalid --output-format value %q, expected srt or vtt\n":               "Неверное значение --output-format %q, ожидается srt или vtt\n",
+		"--spellcheck needs hunspell in PATH":                                   "Для --spellcheck нужен hunspell в PATH",
+		"--merge-short, --merge-chars and --merge-gap must not be negative":     "--merge-short, --merge-chars и --merge-gap не могут быть отрицательными",
+		"--input and --input-list cannot be used together":                      "--input и --input-list нельзя использовать вместе",
+		"Invalid --input-list: %v\n":                                            "Неверный --input-list: %v\n",
+		"--min-gap and --max-duration must not be negative":                     "--min-gap и --max-duration не могут быть отрицательными",
+		"--temperature, --max-tokens and --context-window must not be negative": "--temperature, --max-tokens и --context-window не могут быть отрицательными",
+		"Failed to load prompt settings: %v\n":                                  "Не удалось загрузить настройки промпта: %v\n",
+		"--retry-workers must be >= 0":                                          "--retry-workers должно быть >= 0",
+		"--max-errors must be >= 0 and --max-error-rate between 0 and 1":        "--max-errors должно быть >= 0, а --max-error-rate — от 0 до 1",
+		"Invalid --preserve value %q, expected mode, mtime or owner\n":          "Неверное значение --preserve %q, ожидается mode, mtime или owner\n",
+		"--max-inflight-lines must be >= 0":                                     "--max-inflight-lines должно быть >= 0",
+		"Frame rates must be positive":                                          "Частота кадров должна быть положительной",
+		"Failed to open error log file: %v\n":                                   "Не удалось открыть журнал ошибок: %v\n",
+		"🧠 Loaded %d cached translations from %s\n":                             "🧠 Загружено переводов из кэша %[2]s: %[1]d\n",
+		"✅ Completed: %d files, %d lines in %v":                                 "✅ Готово: файлов: %d, строк: %d, время: %v",
+		"🧠 Cache: %s\n": "🧠 Кэш: %s\n",
+		"%d hits (%d persistent, %d in-memory), %d misses, %.1f%% hit ratio, %d characters saved": "попаданий: %d (из файла: %d, в памяти: %d), промахов: %d, доля попаданий: %.1f%%, сэкономлено символов: %d",
+		"📏 Style guide %s: %d of %d cues compliant\n":                                             "📏 Руководство по стилю %s: соответствуют реплик: %d из %d\n",
+		"🧩 Merged %d short cues into the cues before them\n":                                      "🧩 Присоединено коротких реплик к предыдущим: %d\n",
+		"⏱️ Shortened %d cues for --min-gap/--max-duration\n":                                     "⏱️ Укорочено реплик ради --min-gap/--max-duration: %d\n",
+		"🛰️ Daemon listening on %s, jobs in %s\n":                                                 "🛰️ Демон слушает %s, задания в %s\n",
+		"🛑 Stopping; running jobs will be resumed on the next start":                              "🛑 Остановка; выполняемые задания продолжатся при следующем запуске",
+		"▶️ Job %d: %s → %s\n":                                                                    "▶️ Задание %d: %s → %s\n",
+		"⏹️ Job %d: %s (exit code %d)\n":                                                          "⏹️ Задание %d: %s (код выхода %d)\n",
+		"📥 Queued job %d: %s → %s\n":                                                              "📥 Задание %d поставлено в очередь: %s → %s\n",
+		"🔎 Quality report: %d issue(s) in %s\n":                                                   "🔎 Отчёт о качестве: замечаний: %d, файл %s\n",
+		"✍️ Post-edited %d cues with the LLM\n":                                                   "✍️ Отредактировано LLM реплик: %d\n",
+		"♻️ Reused %d unchanged cues from previous outputs\n":                                     "♻️ Взято без изменений из прошлых переводов реплик: %d\n",
+		"📄 Lines per file:":                                                                       "📄 Строки по файлам:",
+		"%d translated, %d from cache, %d skipped, %d failed":                                     "переведено: %d, из кэша: %d, пропущено: %d, с ошибкой: %d",
+		"📊 Lines: %s\n": "📊 Строки: %s\n",
+		"\n🔁 Retrying %d line(s) from %d file(s)...\n":                                              "\n🔁 Повтор строк: %d, файлов: %d...\n",
+		"🔁 Recovered %d of %d line(s)\n":                                                            "🔁 Восстановлено строк: %d из %d\n",
+		"📤 Exported %d cached translations to %s\n":                                                 "📤 Выгружено переводов из кэша в %[2]s: %[1]d\n",
+		"📥 Imported %d translations into %s (%d total)\n":                                           "📥 Загружено переводов в %[2]s: %[1]d (всего %[3]d)\n",
+		"🔀 Merged %d + %d cues into %d cues: %s\n":                                                  "🔀 Объединено %d + %d реплик в %d: %s\n",
+		"🏁 Benchmarking %s %s → %s with %d lines\n":                                                 "🏁 Замер %s %s → %s, строк: %d\n",
+		"  %d worker(s): %v\n":                                                                      "  потоков: %d: %v\n",
+		"--force and --skip-existing cannot be combined":                                            "--force и --skip-existing нельзя использовать вместе",
+		"\n❓ %s already exists: [o]verwrite, [s]kip, [r]ename the existing file, overwrite [a]ll? ": "\n❓ %s уже существует: [o] перезаписать, [s] пропустить, [r] переименовать старый файл, [a] перезаписывать все? ",
+		"📦 Renamed to %s\n":                                                                         "📦 Переименован в %s\n",
+		"⏭️ Skipped %d file(s) with existing outputs\n":                                             "⏭️ Пропущено файлов с готовым переводом: %d\n",
+		"⚠️ Could not check language codes: %v\n":                                                   "⚠️ Не удалось проверить коды языков: %v\n",
+	},
+}
+
+// initUILang picks the message language from --ui-lang, else from the
+// LC_ALL, LC_MESSAGES and LANG environment variables (e.g. ru_RU.UTF-8).
+func initUILang() {
+	lang := uiLangFlag
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang != "" {
+			break
+		}
+		lang = os.Getenv(env)
+	}
+	lang, _, _ = strings.Cut(strings.ToLower(lang), ".")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang, _, _ = strings.Cut(lang, "-")
+	if _, ok := uiMessages[lang]; ok {
+		uiLang = lang
+	}
+}
+
+// tr returns the translation of a message format in the UI language.
+func tr(msg string) string {
+	if translated, ok := uiMessages[uiLang][msg]; ok {
+		return translated
+	}
+	return msg
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readInputList reads the files named by --input-list, one per line, from
+// a file or from stdin for "-". Blank lines and lines starting with # are
+// skipped and repeated paths are kept once.
+func readInputList(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			return nil, fmt.Errorf("%s:%d: URLs are not supported, download %s first", name, n, line)
+		}
+		path, err := resolvePath(filepath.Clean(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s lists no files", name)
+	}
+	return paths, nil
+}
+
+// commonDir is the deepest directory containing all paths; --output-dir
+// mirrors the listed files below it.
+func commonDir(paths []string) string {
+	dir := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !isWithin(path, dir) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// processFileList translates the listed files like processDirectory does
+// with the files it finds. Listed files are taken as they are: no extension
+// filter, and a missing file is a failure rather than a reason to stop.
+func processFileList(paths []string, lang string) error {
+	batch := newFileBatch(lang)
+	for _, path := range paths {
+		if aborted() != nil {
+			break
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			if err == nil {
+				err = errors.New("is a directory")
+			}
+			logError(fmt.Sprintf("Access error %s: %v", path, err))
+			batch.fail(fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if !batch.add(path) {
+			break
+		}
+	}
+	return batch.wait()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadInputList(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "b.vtt")
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "comments, blanks and duplicates",
+			content: "\ufeff# episodes\na.vtt\n\n  ./a.vtt  \n" + abs + "\nsub/../c.srt\r\n",
+			want:    []string{"a.vtt", abs, "c.srt"},
+		},
+		{
+			name:    "URL",
+			content: "a.vtt\nhttps://example.com/b.vtt\n",
+			wantErr: "list:2: URLs are not supported",
+		},
+		{
+			name:    "empty",
+			content: "# nothing yet\n\n",
+			wantErr: "lists no files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := filepath.Join(dir, "list")
+			if err := os.WriteFile(list, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readInputList(list)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	p := filepath.FromSlash
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{p("/media/show/s01/e01.vtt")}, p("/media/show/s01")},
+		{[]string{p("/media/show/s01/e01.vtt"), p("/media/show/s01/e02.vtt")}, p("/media/show/s01")},
+		{[]string{p("/media/show/s01/e01.vtt"), p("/media/show/s02/e01.vtt")}, p("/media/show")},
+		{[]string{p("/media/show/s01/e01.vtt"), p("/media/show-extras/e01.vtt")}, p("/media")},
+		{[]string{p("/media/a/x.vtt"), p("/srv/b/y.vtt")}, p("/")},
+		{[]string{p("s01/e01.vtt"), p("s02/e01.vtt")}, "."},
+	}
+	for _, tt := range tests {
+		if got := commonDir(tt.paths); got != tt.want {
+			t.Errorf("commonDir(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runJobsCommand talks to a running daemon:
+//
+//	jobs add [--server url] [--token secret] [--output-dir dir] <path>   (languages from --lang)
+//	jobs list [--server url] [--token secret]
+//	jobs show [--server url] [--token secret] <id>
+//	jobs cancel [--server url] [--token secret] <id>
+func runJobsCommand(args []string) error {
+	usage := errors.New("usage: jobs add <path> | jobs list | jobs show <id> | jobs cancel <id>")
+	if len(args) == 0 {
+		return usage
+	}
+	fs := flag.NewFlagSet("jobs "+args[0], flag.ContinueOnError)
+	server := fs.String("server", "http://localhost:8080", "URL of the daemon")
+	token := fs.String("token", "", "Token of the daemon's --token, or a secret reference")
+	jobOutputDir := fs.String("output-dir", outputDir, "Output directory of the job")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(*server, "/") + "/jobs"
+	secret, err := resolveSecret(*token)
+	if err != nil {
+		return fmt.Errorf("--token: %w", err)
+	}
+	request := func(method, url string, body, reply any) error {
+		return jobsRequest(method, url, secret, body, reply)
+	}
+
+	switch {
+	case args[0] == "add" && fs.NArg() == 1:
+		langs := parseLangs(targetLang)
+		if len(langs) == 0 {
+			return errors.New("please specify the job's languages with --lang before `jobs`")
+		}
+		// The daemon may run in another directory
+		input, err := filepath.Abs(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		out := *jobOutputDir
+		if out != "" {
+			if out, err = filepath.Abs(out); err != nil {
+				return err
+			}
+		}
+		// One job per language, so each can be followed and retried alone
+		for _, lang := range langs {
+			var j job
+			if err := request("POST", base, job{Input: input, Lang: lang, OutputDir: out}, &j); err != nil {
+				return err
+			}
+			statusf("📥 Queued job %d: %s → %s\n", j.ID, j.Input, j.Lang)
+		}
+		return nil
+	case args[0] == "list" && fs.NArg() == 0:
+		var jobs []job
+		if err := request("GET", base, nil, &jobs); err != nil {
+			return err
+		}
+		printJobs(jobs)
+		return nil
+	case (args[0] == "show" || args[0] == "cancel") && fs.NArg() == 1:
+		method := "GET"
+		if args[0] == "cancel" {
+			method = "DELETE"
+		}
+		var j job
+		if err := request(method, base+"/"+fs.Arg(0), nil, &j); err != nil {
+			return err
+		}
+		printJobs([]job{j})
+		for _, line := range j.Output {
+			fmt.Println("  " + line)
+		}
+		return nil
+	}
+	return usage
+}
+
+// jobsRequest calls the daemon's REST API and decodes its JSON reply.
+func jobsRequest(method, url, token string, body, reply any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(runCtx, method, url, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("is the daemon running? %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+func printJobs(jobs []job) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "id\tstatus\tlang\tcreated\ttook\tinput")
+	for _, j := range jobs {
+		took := "-"
+		if j.Started != nil && j.Finished != nil {
+			took = j.Finished.Sub(*j.Started).Round(time.Second).String()
+		}
+		status := j.Status
+		if j.Status == jobFailed {
+			status = fmt.Sprintf("%s (%d)", j.Status, j.ExitCode)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", j.ID, status, j.Lang, j.Created.Format("2006-01-02 15:04"), took, j.Input)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func keyringSecret(name string) (string, error) {
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return secretCommand("keyring:"+name, "secret-tool", "lookup", "service", keyringService, "account", name)
+	case "darwin":
+		return secretCommand("keyring:"+name, "security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	}
+	return "", fmt.Errorf("secret keyring:%s: the OS keyring is not supported on %s, use env: or file:", name, runtime.GOOS)
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32     = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead = advapi32.NewProc("CredReadW")
+	procCredFree = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1
+	errorNotFound   = syscall.Errno(1168)
+)
+
+// credential is the CREDENTIALW structure of wincred.h.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keyringSecret reads the generic credential "vtt-translator:<name>" from
+// the Windows Credential Manager, as stored by
+// `cmdkey /generic:vtt-translator:<name> /user:<name> /pass`.
+func keyringSecret(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(keyringService + ":" + name)
+	if err != nil {
+		return "", fmt.Errorf("secret keyring:%s: %w", name, err)
+	}
+	var cred *credential
+	ok, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if errors.Is(err, errorNotFound) {
+			return "", fmt.Errorf("secret keyring:%s is empty or not found", name)
+		}
+		return "", fmt.Errorf("secret keyring:%s: Credential Manager: %w", name, err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	// cmdkey and the Credential Manager UI store the password as UTF-16
+	blob := unsafe.Slice((*uint16)(unsafe.Pointer(cred.CredentialBlob)), cred.CredentialBlobSize/2)
+	value := string(utf16.Decode(blob))
+	if value == "" {
+		return "", fmt.Errorf("secret keyring:%s is empty or not found", name)
+	}
+	return value, nil
+}
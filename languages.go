@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// language is a source language a provider supports and the target
+// languages it can be translated into.
+type language struct {
+	Code    string   `json:"code"`
+	Name    string   `json:"name"`
+	Targets []string `json:"targets"`
+}
+
+// errNoLanguageList is returned by providers whose languages depend on the
+// model rather than on a list the API can report.
+var errNoLanguageList = errors.New("the provider has no fixed language list")
+
+// runLanguagesCommand prints the language codes the configured provider
+// accepts: `languages`.
+func runLanguagesCommand(args []string) error {
+	fs := flag.NewFlagSet("languages", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := selectProvider(); err != nil {
+		return err
+	}
+	langs, err := provider.languages()
+	if err != nil {
+		return err
+	}
+	rememberLanguages(langs)
+
+	sort.Slice(langs, func(i, j int) bool { return langs[i].Code < langs[j].Code })
+	width := 0
+	for _, l := range langs {
+		width = max(width, len(l.Name))
+	}
+	fmt.Printf("🌐 %s: %d source language(s)\n", providerName, len(langs))
+	for _, l := range langs {
+		targets := append([]string(nil), l.Targets...)
+		sort.Strings(targets)
+		fmt.Printf("  %-8s %-*s → %s\n", l.Code, width, l.Name, strings.Join(targets, ", "))
+	}
+	return nil
+}
+
+// validateLanguages checks the language pair against the provider's list
+// before any work starts, so a typo such as "rus" fails once instead of on
+// every line. Providers without a list, or an unreachable one, are not
+// checked.
+func validateLanguages(source string, targets []string) error {
+	langs, err := provider.languages()
+	if errors.Is(err, errNoLanguageList) {
+		return nil
+	}
+	if err != nil {
+		statusf("⚠️ Could not check language codes: %v\n", err)
+		return nil
+	}
+	rememberLanguages(langs)
+
+	codes := make([]string, len(langs))
+	var src *language
+	for i := range langs {
+		codes[i] = langs[i].Code
+		if langs[i].Code == source {
+			src = &langs[i]
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("%s does not support source language %q%s", providerName, source, suggestLanguage(source, codes))
+	}
+	for _, target := range targets {
+		if target != source && !slices.Contains(src.Targets, target) {
+			return fmt.Errorf("%s cannot translate %s to %q%s", providerName, source, target, suggestLanguage(target, src.Targets))
+		}
+	}
+	return nil
+}
+
+// suggestLanguage hints at codes sharing the first letters with a mistyped
+// one ("rus" → "ru") and at the languages command.
+func suggestLanguage(code string, codes []string) string {
+	var similar []string
+	for _, c := range codes {
+		if len(code) >= 2 && len(c) >= 2 && strings.EqualFold(c[:2], code[:2]) {
+			similar = append(similar, c)
+		}
+	}
+	hint := ", run `vtt-translator languages` for the supported codes"
+	if len(similar) > 0 {
+		hint = fmt.Sprintf(" (did you mean %s?)%s", strings.Join(similar, " or "), hint)
+	}
+	return hint
+}
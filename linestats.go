@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// lineStats breaks the lines of a file down by what happened to them.
+// Skipped lines were never sent: timings, cue numbers, blank lines, kept
+// notes and chapter metadata, and cues reused from the previous output.
+type lineStats struct {
+	translated int64
+	cached     int64
+	skipped    int64
+	failed     int64
+}
+
+// fileStats is the breakdown of one output file. It also remembers which
+// cues still hold source text, so they are not recorded as translated.
+type fileStats struct {
+	inputPath string
+	lang      string
+	lineStats
+
+	mu         sync.Mutex
+	failedCues map[*block]int
+}
+
+var (
+	fileStatsMu  sync.Mutex
+	fileStatsAll []*fileStats
+)
+
+// newFileStats registers the breakdown of a file for the run summary.
+func newFileStats(inputPath, lang string) *fileStats {
+	s := &fileStats{inputPath: inputPath, lang: lang}
+	fileStatsMu.Lock()
+	defer fileStatsMu.Unlock()
+	fileStatsAll = append(fileStatsAll, s)
+	return s
+}
+
+// done counts a line that was translated, from the cache or not.
+func (s *lineStats) done(cached bool) {
+	if cached {
+		atomic.AddInt64(&s.cached, 1)
+	} else {
+		atomic.AddInt64(&s.translated, 1)
+	}
+}
+
+// recovered moves a failed line that succeeded on retry to done.
+func (s *lineStats) recovered(cached bool) {
+	atomic.AddInt64(&s.failed, -1)
+	s.done(cached)
+}
+
+// lineFailed counts a line of cue b that kept its original text.
+func (s *fileStats) lineFailed(b *block) {
+	atomic.AddInt64(&s.failed, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failedCues == nil {
+		s.failedCues = map[*block]int{}
+	}
+	s.failedCues[b]++
+}
+
+// lineRecovered counts a failed line of cue b that succeeded on retry.
+func (s *fileStats) lineRecovered(b *block, cached bool) {
+	s.recovered(cached)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failedCues[b]--; s.failedCues[b] <= 0 {
+		delete(s.failedCues, b)
+	}
+}
+
+// hasFailedLines reports whether some line of b kept its original text.
+func (s *fileStats) hasFailedLines(b *block) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failedCues[b] > 0
+}
+
+func (s *lineStats) String() string {
+	return fmt.Sprintf(tr("%d translated, %d from cache, %d skipped, %d failed"),
+		atomic.LoadInt64(&s.translated), atomic.LoadInt64(&s.cached), atomic.LoadInt64(&s.skipped), atomic.LoadInt64(&s.failed))
+}
+
+// printLineStats prints the breakdown of every file, flagging files where
+// lines failed and kept their original text, and the total.
+func printLineStats() {
+	fileStatsMu.Lock()
+	files := append([]*fileStats(nil), fileStatsAll...)
+	fileStatsMu.Unlock()
+	if len(files) == 0 {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].inputPath != files[j].inputPath {
+			return files[i].inputPath < files[j].inputPath
+		}
+		return files[i].lang < files[j].lang
+	})
+
+	var total lineStats
+	statusln("📄 Lines per file:")
+	for _, f := range files {
+		// Green: translated, yellow: nothing to translate, red: lines failed
+		mark, color := "  ", colorGreen
+		if f.failed > 0 {
+			mark, color = "⚠️", colorRed
+		} else if f.translated+f.cached == 0 {
+			color = colorYellow
+		}
+		statusln(colorize(color, fmt.Sprintf("  %s %s [%s]: %s", mark, f.inputPath, f.lang, &f.lineStats)))
+		total.translated += f.translated
+		total.cached += f.cached
+		total.skipped += f.skipped
+		total.failed += f.failed
+	}
+	statusf("📊 Lines: %s\n", &total)
+}
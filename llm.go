@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	postEditBatch = 20 // max cues per post-editing request
+	llmTimeout    = 2 * time.Minute
+
+	// defaultContextWindow is assumed for models missing from contextWindows,
+	// small enough for most local models.
+	defaultContextWindow = 8192
+)
+
+// contextWindows lists context sizes (in tokens) of common models, used to
+// keep post-editing batches within what the model accepts.
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-4.1":       1047576,
+	"gpt-4.1-mini":  1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+}
+
+// errContextExceeded marks a reply cut short or rejected for its size.
+var errContextExceeded = errors.New("batch exceeds the model context or --max-tokens")
+
+// defaultPostEditPrompt is the built-in prompt template, see --prompt-template
+// for the placeholders. Without {cues} the template becomes the system
+// message and the cues are sent as the user message.
+const defaultPostEditPrompt = `You are a professional subtitle editor. You receive subtitle cues machine-translated from {source_lang} to {target_lang} as a JSON array of objects with "id", "source" and "translation".
+Fix grammar, word choice and fluency of each translation. Keep the meaning and roughly the same length, keep line breaks and markup tags such as <i>.
+Reply with only a JSON array of objects with "id" and "text", one for every input cue, in the same order.{glossary}`
+
+var (
+	promptTemplate = defaultPostEditPrompt
+	glossaries     = map[string]string{} // target language -> formatted glossary
+)
+
+// loadPromptSettings reads --prompt-template and, for every target
+// language, --glossary (where "{lang}" in the path is the language code).
+func loadPromptSettings(langs []string) error {
+	if promptTemplatePath != "" {
+		data, err := os.ReadFile(promptTemplatePath)
+		if err != nil {
+			return err
+		}
+		promptTemplate = string(data)
+	}
+	if glossaryPath == "" {
+		return nil
+	}
+	for _, lang := range langs {
+		path := strings.ReplaceAll(glossaryPath, "{lang}", lang)
+		text, err := readGlossary(path)
+		if err != nil {
+			return err
+		}
+		glossaries[lang] = text
+	}
+	return nil
+}
+
+// readGlossary reads "term = translation" lines ("#" starts a comment) and
+// formats them as a list for the prompt.
+func readGlossary(path string) (string, error) {
+	lines, _, err := readLines(path)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		term, translation, ok := strings.Cut(line, "=")
+		if !ok {
+			return "", fmt.Errorf("%s:%d: expected \"term = translation\"", path, i+1)
+		}
+		fmt.Fprintf(&sb, "- %s → %s\n", strings.TrimSpace(term), strings.TrimSpace(translation))
+	}
+	return sb.String(), nil
+}
+
+// promptMessages fills the template placeholders {source_lang},
+// {target_lang}, {glossary} and {cues}.
+func promptMessages(lang, cues string) []chatMessage {
+	glossary := glossaries[lang]
+	if promptTemplate == defaultPostEditPrompt && glossary != "" {
+		glossary = "\nAlways use these term translations:\n" + glossary
+	}
+	r := strings.NewReplacer(
+		"{source_lang}", sourceLang,
+		"{target_lang}", lang,
+		"{glossary}", glossary,
+		"{cues}", cues,
+	)
+	prompt := r.Replace(promptTemplate)
+	if strings.Contains(promptTemplate, "{cues}") {
+		return []chatMessage{{Role: "user", Content: prompt}}
+	}
+	return []chatMessage{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: cues},
+	}
+}
+
+var postEditedCounter int64
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// chatComplete sends one conversation to an OpenAI-compatible
+// /chat/completions endpoint and returns the assistant's reply.
+func chatComplete(messages []chatMessage) (string, error) {
+	body, err := json.Marshal(chatRequest{
+		Model:       postEditModel,
+		Messages:    messages,
+		Temperature: llmTemperature,
+		MaxTokens:   llmMaxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, llmTimeout)
+	defer cancel()
+
+	url := strings.TrimRight(llmURL, "/") + "/chat/completions"
+	reqHTTP, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	reqHTTP.Header.Set("Content-Type", "application/json")
+	if key := llmAPIKey(); key != "" {
+		reqHTTP.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(reqHTTP)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to close response body: %v", err))
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		message := strings.TrimSpace(string(detail))
+		// Only an oversized prompt is worth retrying in smaller batches; other
+		// 400s (bad key, unknown model, bad --max-tokens) fail the same way
+		if resp.StatusCode == http.StatusRequestEntityTooLarge ||
+			resp.StatusCode == http.StatusBadRequest && (strings.Contains(message, "context_length_exceeded") || strings.Contains(message, "maximum context length")) {
+			return "", fmt.Errorf("%w: %s: %s", errContextExceeded, resp.Status, message)
+		}
+		err := &apiStatusError{code: resp.StatusCode, status: resp.Status}
+		if message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+
+	var res chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	if len(res.Choices) == 0 {
+		return "", errors.New("LLM response has no choices")
+	}
+	if res.Choices[0].FinishReason == "length" {
+		return "", fmt.Errorf("%w: reply was truncated", errContextExceeded)
+	}
+	return res.Choices[0].Message.Content, nil
+}
+
+func contextWindow() int {
+	if llmContextWindow > 0 {
+		return llmContextWindow
+	}
+	if n, ok := contextWindows[postEditModel]; ok {
+		return n
+	}
+	return defaultContextWindow
+}
+
+// estimateTokens is a deliberately pessimistic guess (three characters per
+// token) that also holds for Cyrillic and CJK text.
+func estimateTokens(s string) int {
+	return utf8.RuneCountInString(s)/3 + 1
+}
+
+// cueTokens estimates what one cue adds to the request and to the reply.
+func cueTokens(c postEditCue) (in, out int) {
+	translation := estimateTokens(strings.Join(c.cue.lines, "\n"))
+	return estimateTokens(strings.Join(c.source, "\n")) + translation + 10, translation*3/2 + 10
+}
+
+// postEditBatches groups cues into batches of at most postEditBatch cues
+// whose estimated prompt and reply fit the context window and --max-tokens.
+func postEditBatches(cues []postEditCue, lang string) [][]postEditCue {
+	overhead := 0
+	for _, m := range promptMessages(lang, "") {
+		overhead += estimateTokens(m.Content)
+	}
+	window := contextWindow()
+
+	var batches [][]postEditCue
+	var batch []postEditCue
+	var in, out int
+	for _, c := range cues {
+		cin, cout := cueTokens(c)
+		tooBig := overhead+in+cin+out+cout > window || llmMaxTokens > 0 && out+cout > llmMaxTokens
+		if len(batch) > 0 && (len(batch) == postEditBatch || tooBig) {
+			batches = append(batches, batch)
+			batch, in, out = nil, 0, 0
+		}
+		batch = append(batch, c)
+		in, out = in+cin, out+cout
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func llmAPIKey() string {
+	if llmKey != "" {
+		return llmKey
+	}
+	return os.Getenv("OPENAI_API_KEY")
+}
+
+// postEditCue is a machine-translated cue together with its source text.
+type postEditCue struct {
+	cue    *block
+	source []string
+}
+
+type postEditItem struct {
+	ID          int    `json:"id"`
+	Source      string `json:"source,omitempty"`
+	Translation string `json:"translation,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// postEditCues polishes the MT output of the given cues with the LLM in
+// batches. A batch that fails or comes back malformed keeps the MT output.
+func postEditCues(cues []postEditCue, lang, inputPath string) {
+	for _, batch := range postEditBatches(cues, lang) {
+		if aborted() != nil {
+			return
+		}
+		if err := postEditSplitting(batch, lang); err != nil {
+			logError(fmt.Sprintf("Post-edit error in file '%s' [%d cues from %s]: %v", inputPath, len(batch), batch[0].cue.timing, err))
+		}
+	}
+}
+
+// postEditSplitting retries a batch the model rejected as too large in two
+// halves, down to single cues.
+func postEditSplitting(batch []postEditCue, lang string) error {
+	err := postEditBatchOf(batch, lang)
+	if !errors.Is(err, errContextExceeded) || len(batch) == 1 {
+		return err
+	}
+	half := len(batch) / 2
+	return errors.Join(postEditSplitting(batch[:half], lang), postEditSplitting(batch[half:], lang))
+}
+
+func postEditBatchOf(batch []postEditCue, lang string) error {
+	items := make([]postEditItem, len(batch))
+	for i, c := range batch {
+		items[i] = postEditItem{
+			ID:          i + 1,
+			Source:      strings.Join(c.source, "\n"),
+			Translation: strings.Join(c.cue.lines, "\n"),
+		}
+	}
+	// Keep <i> and & readable for the model instead of \u003c escapes
+	var payload bytes.Buffer
+	enc := json.NewEncoder(&payload)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(items); err != nil {
+		return err
+	}
+
+	reply, err := chatComplete(promptMessages(lang, payload.String()))
+	if err != nil {
+		return err
+	}
+
+	edited, err := parsePostEditReply(reply)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]string, len(edited))
+	for _, item := range edited {
+		byID[item.ID] = item.Text
+	}
+	for i, c := range batch {
+		lines := nonEmptyLines(byID[i+1])
+		if len(lines) == 0 {
+			continue
+		}
+		c.cue.lines = lines
+		atomic.AddInt64(&postEditedCounter, 1)
+	}
+	return nil
+}
+
+// translatedEdits drops cues with lines the machine translation failed on:
+// they still hold source text, not a translation to polish.
+func translatedEdits(edits []postEditCue, stats *fileStats) []postEditCue {
+	return slices.DeleteFunc(edits, func(c postEditCue) bool { return stats.hasFailedLines(c.cue) })
+}
+
+// nonEmptyLines splits an edited cue into lines, dropping blank ones: a
+// blank line would end the cue in the rendered file.
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \r"))
+		}
+	}
+	return lines
+}
+
+// parsePostEditReply extracts the JSON array from the reply, tolerating
+// models that wrap it in prose or a ```json fence.
+func parsePostEditReply(reply string) ([]postEditItem, error) {
+	start := strings.Index(reply, "[")
+	end := strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in LLM reply: %.200q", reply)
+	}
+	var items []postEditItem
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &items); err != nil {
+		return nil, fmt.Errorf("malformed LLM reply: %w", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePostEditReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    []postEditItem
+		wantErr bool
+	}{
+		{
+			name:  "bare array",
+			reply: `[{"id": 1, "text": "Привет"}, {"id": 2, "text": "Пока"}]`,
+			want:  []postEditItem{{ID: 1, Text: "Привет"}, {ID: 2, Text: "Пока"}},
+		},
+		{
+			name:  "fenced",
+			reply: "Here you go:\n```json\n[{\"id\": 1, \"text\": \"<i>Да</i>\\nнет\"}]\n```",
+			want:  []postEditItem{{ID: 1, Text: "<i>Да</i>\nнет"}},
+		},
+		{
+			name:    "no array",
+			reply:   "I cannot help with that.",
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			reply:   `[{"id": 1, "text": }]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePostEditReply(tt.reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonEmptyLines(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"One\nTwo", []string{"One", "Two"}},
+		{"One\n\n  \nTwo  \r", []string{"One", "Two"}},
+		{"\n", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := nonEmptyLines(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("nonEmptyLines(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPromptMessages(t *testing.T) {
+	defer func(template, source string, glossary map[string]string) {
+		promptTemplate, sourceLang, glossaries = template, source, glossary
+	}(promptTemplate, sourceLang, glossaries)
+	sourceLang = "en"
+	glossaries = map[string]string{"ru": "- Jedi → джедай\n"}
+
+	tests := []struct {
+		name     string
+		template string
+		lang     string
+		want     []chatMessage
+	}{
+		{
+			name:     "template with {cues} is one user message",
+			template: "Edit {source_lang}→{target_lang}:{glossary}\n{cues}",
+			lang:     "ru",
+			want:     []chatMessage{{Role: "user", Content: "Edit en→ru:- Jedi → джедай\n\n[1]"}},
+		},
+		{
+			name:     "template without {cues} is the system message",
+			template: "Edit {source_lang}→{target_lang}.",
+			lang:     "de",
+			want:     []chatMessage{{Role: "system", Content: "Edit en→de."}, {Role: "user", Content: "[1]"}},
+		},
+		{
+			name:     "built-in template introduces the glossary",
+			template: defaultPostEditPrompt,
+			lang:     "ru",
+			want: []chatMessage{
+				{Role: "system", Content: strings.NewReplacer("{source_lang}", "en", "{target_lang}", "ru", "{glossary}", "\nAlways use these term translations:\n- Jedi → джедай\n").Replace(defaultPostEditPrompt)},
+				{Role: "user", Content: "[1]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			promptTemplate = tt.template
+			if got := promptMessages(tt.lang, "[1]"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadGlossary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glossary.txt")
+	if err := os.WriteFile(path, []byte("# Star Wars\nJedi = джедай\n\n  the Force =  Сила  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readGlossary(path)
+	if want := "- Jedi → джедай\n- the Force → Сила\n"; err != nil || got != want {
+		t.Errorf("readGlossary() = %q, %v, want %q", got, err, want)
+	}
+
+	if err := os.WriteFile(path, []byte("Jedi = джедай\nlightsaber\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readGlossary(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("readGlossary() error = %v, want one for line 2", err)
+	}
+}
+
+func TestPostEditBatches(t *testing.T) {
+	defer func(window, maxTokens int) {
+		llmContextWindow, llmMaxTokens = window, maxTokens
+	}(llmContextWindow, llmMaxTokens)
+
+	cues := func(n, chars int) []postEditCue {
+		var list []postEditCue
+		for range n {
+			text := strings.Repeat("x", chars)
+			list = append(list, postEditCue{cue: &block{kind: blockCue, lines: []string{text}}, source: []string{text}})
+		}
+		return list
+	}
+	tests := []struct {
+		name      string
+		cues      []postEditCue
+		window    int
+		maxTokens int
+		sizes     []int
+	}{
+		{"none", nil, 8192, 0, nil},
+		{"batch size", cues(45, 30), 100000, 0, []int{postEditBatch, postEditBatch, 5}},
+		{"context window", cues(10, 300), 1500, 0, []int{3, 3, 3, 1}},
+		{"max tokens", cues(10, 30), 100000, 70, []int{2, 2, 2, 2, 2}},
+		{"a cue too big still goes alone", cues(2, 9000), 1500, 0, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llmContextWindow, llmMaxTokens = tt.window, tt.maxTokens
+			var sizes []int
+			var all []postEditCue
+			for _, batch := range postEditBatches(tt.cues, "ru") {
+				sizes = append(sizes, len(batch))
+				all = append(all, batch...)
+			}
+			if !slices.Equal(sizes, tt.sizes) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tt.sizes)
+			}
+			if len(all) != len(tt.cues) {
+				t.Errorf("batches hold %d cues, want %d", len(all), len(tt.cues))
+			}
+			for i := range all {
+				if all[i].cue != tt.cues[i].cue {
+					t.Fatalf("cue %d out of order", i)
+				}
+			}
+		})
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -17,9 +19,20 @@ import (
 	"time"
 
 	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
+// Exit codes, so wrapping scripts can tell a clean run from one whose
+// output still contains untranslated lines.
+const (
+	exitOK           = 0 // everything translated (returning from main)
+	exitSetupError   = 1 // bad flags, unreadable input, log or cache problems
+	exitFileFailures = 2 // run completed, but some files failed
+	exitLineFailures = 3 // run completed, but some lines kept their original text
+	exitAborted      = 4 // run aborted by --max-errors / --max-error-rate
+)
+
 const translateURL = "http://localhost:5001/translate"
 
 type TranslateRequest struct {
@@ -27,6 +40,7 @@ type TranslateRequest struct {
 	Source string `json:"source"`
 	Target string `json:"target"`
 	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
 }
 
 type TranslateResponse struct {
@@ -34,101 +48,520 @@ type TranslateResponse struct {
 }
 
 var (
-	errorLog         *os.File
-	translationCache sync.Map
-	fileCounter      int64
-	lineCounter      int64
-	globalBar        *progressbar.ProgressBar
+	errorLog           *os.File
+	translationCache   sync.Map
+	fileCounter        int64
+	lineCounter        int64
+	reusedCueCounter   int64
+	fixedTimingCounter int64
+	mergedCueCounter   int64
+	skippedFileCounter int64
+	failedLineCount    int64
+	globalBar          *progressbar.ProgressBar
 )
 
 var (
-	inputPath  string
-	targetLang string
-	workers    int
+	inputPath   string
+	inputList   string
+	sourceLang  string
+	targetLang  string
+	targetLangs []string
+	inputRoot   string
+	outputDir   string
+	workers     int
+	cachePath   string
+	statePath   string
+
+	translateHeader bool
+	translateNotes  bool
+	chapterMode     string
+	timeShift       time.Duration
+	timeScale       float64
+	minGap          time.Duration
+	maxDuration     time.Duration
+	mergeShort      time.Duration
+	mergeChars      int
+	mergeGap        time.Duration
+	inputFPS        float64
+	outputFPS       float64
+	outputFormat    string
+	maxErrors       int
+	maxErrorRate    float64
+	retryWorkers    int
+	spellCheck      bool
+	spellDict       string
+	qualityReport   string
+	styleGuide      string
+	postEdit        bool
+	llmURL          string
+	llmKey          string
+	providerName    string
+	endpointsPath   string
+	ollamaURL       string
+	hfURL           string
+	hfToken         string
+	llmModel        string
+	postEditModel   string
+	llmTemperature  float64
+	llmMaxTokens    int
+
+	llmContextWindow int
+
+	promptTemplatePath string
+	glossaryPath       string
+	pprofAddr          string
+	maxInflightLines   int
+	noColor            bool
+	forceOverwrite     bool
+	skipExisting       bool
+	uiLangFlag         string
+	preserveList       string
+	preserve           = map[string]bool{}
 )
 
+// inflightLines bounds the lines of all files held in memory by directory
+// runs to --max-inflight-lines; nil means no bound.
+var inflightLines *semaphore.Weighted
+
 func init() {
 	flag.StringVar(&inputPath, "input", "", "Path to a file or directory")
-	flag.StringVar(&targetLang, "lang", "ru", "Target translation language")
+	flag.StringVar(&inputList, "input-list", "", "File listing the files to translate, one per line, or - for stdin (instead of --input)")
+	flag.StringVar(&sourceLang, "source", "en", "Source language of the subtitles")
+	flag.StringVar(&targetLang, "lang", "ru", "Target translation language, or a comma-separated list (ru,de)")
+	flag.StringVar(&outputDir, "output-dir", "", "Write outputs to <dir>/<lang>/... mirroring the input tree instead of next to the sources")
 	flag.IntVar(&workers, "workers", 5, "Number of parallel workers")
-	flag.Parse()
+	flag.StringVar(&providerName, "provider", "libretranslate", "Translation provider: libretranslate, ollama or huggingface")
+	flag.StringVar(&endpointsPath, "endpoints", "", "JSON config file spreading LibreTranslate requests over several weighted endpoints")
+	flag.StringVar(&ollamaURL, "ollama-url", "http://localhost:11434", "Base URL of the Ollama API")
+	flag.StringVar(&hfURL, "hf-url", "https://api-inference.huggingface.co/models/{model}", "HuggingFace Inference API URL ({model} is replaced by --model) or Inference Endpoint URL")
+	flag.StringVar(&hfToken, "hf-token", "", "HuggingFace access token, or a secret reference such as keyring:huggingface (default: $HF_TOKEN)")
+	flag.StringVar(&cachePath, "cache", "translation_cache.json", "Path to the persistent translation cache (empty to disable)")
+	flag.BoolVar(&translateHeader, "translate-header", false, "Translate the WEBVTT header title and free-text header fields")
+	flag.BoolVar(&translateNotes, "translate-notes", false, "Translate WebVTT NOTE comment blocks")
+	flag.StringVar(&chapterMode, "chapters", "auto", "Chapter track handling: auto, on or off")
+	flag.DurationVar(&timeShift, "shift", 0, "Shift all cue timestamps, e.g. 1.5s or -200ms")
+	flag.Float64Var(&timeScale, "scale", 1, "Multiply all cue timestamps to correct drift, e.g. 1.001")
+	flag.DurationVar(&minGap, "min-gap", 0, "End each cue at least this long before the next one starts, e.g. 83ms")
+	flag.DurationVar(&maxDuration, "max-duration", 0, "Shorten cues that stay on screen longer than this, e.g. 7s")
+	flag.DurationVar(&mergeShort, "merge-short", 0, "Before translating, merge consecutive cues while they are shorter than this, e.g. 1.5s")
+	flag.IntVar(&mergeChars, "merge-chars", 0, "With --merge-short, also merge cues with fewer characters than this")
+	flag.DurationVar(&mergeGap, "merge-gap", 500*time.Millisecond, "With --merge-short, never merge cues further apart than this")
+	flag.Float64Var(&inputFPS, "input-fps", 0, "Frame rate of the source: MicroDVD frame timing (default: from file or 23.976) and --output-fps conversion")
+	flag.Float64Var(&outputFPS, "output-fps", 0, "Convert timestamps to this video frame rate, e.g. 25 for PAL (requires --input-fps for time-based inputs)")
+	flag.StringVar(&outputFormat, "output-format", "", "Output format: srt or vtt (default: same as input, srt for MicroDVD)")
+	flag.IntVar(&maxErrors, "max-errors", 0, "Abort the run after more than N failed lines and files (0 = no limit)")
+	flag.Float64Var(&maxErrorRate, "max-error-rate", 0, "Abort the run when the share of failed lines exceeds this fraction, e.g. 0.2 (0 = no limit)")
+	flag.IntVar(&retryWorkers, "retry-workers", 1, "Workers for the final retry pass over transiently failed lines (0 disables it)")
+	flag.BoolVar(&spellCheck, "spellcheck", false, "Check translated cues with hunspell and list likely misspellings in the quality report")
+	flag.StringVar(&spellDict, "spell-dict", "", "hunspell dictionary to use (default: derived from --lang, e.g. ru_RU)")
+	flag.StringVar(&styleGuide, "style-guide", "", "Check outputs against a style guide: netflix, netflix-kids or a JSON rules file; findings go to the quality report")
+	flag.StringVar(&qualityReport, "quality-report", "quality_report.txt", "Path of the quality report written when checks are enabled")
+	flag.BoolVar(&postEdit, "post-edit", false, "Post-edit the machine translation with an LLM (OpenAI-compatible API)")
+	flag.StringVar(&llmURL, "llm-url", "https://api.openai.com/v1", "Base URL of the OpenAI-compatible API used for post-editing")
+	flag.StringVar(&llmKey, "llm-key", "", "API key for --llm-url, or a secret reference such as keyring:openai (default: $OPENAI_API_KEY)")
+	flag.StringVar(&llmModel, "model", "", "Model name for the ollama and huggingface providers")
+	flag.StringVar(&postEditModel, "post-edit-model", "", "Model of --llm-url used by --post-edit (default: --model with the libretranslate provider, else gpt-4o-mini)")
+	flag.Float64Var(&llmTemperature, "temperature", 0.2, "Sampling temperature for the LLM backend")
+	flag.IntVar(&llmMaxTokens, "max-tokens", 0, "Maximum reply tokens per LLM request (0 = backend default)")
+	flag.IntVar(&llmContextWindow, "context-window", 0, "Context size of the post-editing model in tokens (default: known value for --post-edit-model, else 8192)")
+	flag.StringVar(&promptTemplatePath, "prompt-template", "", "Prompt template file for --post-edit with {source_lang}, {target_lang}, {glossary} and {cues} placeholders")
+	flag.StringVar(&glossaryPath, "glossary", "", "Glossary file with \"term = translation\" lines for LLM prompts; {lang} in the path is replaced by the target language")
+	flag.IntVar(&maxInflightLines, "max-inflight-lines", 0, "Limit the subtitle lines of all files being translated at once, to bound memory (0 = no limit)")
+	flag.BoolVar(&forceOverwrite, "force", false, "Overwrite existing outputs without asking")
+	flag.BoolVar(&skipExisting, "skip-existing", false, "Leave existing outputs alone and skip their sources")
+	flag.StringVar(&preserveList, "preserve", "", "Copy attributes of the source file to outputs: comma-separated mode, mtime, owner")
+	flag.StringVar(&uiLangFlag, "ui-lang", "", "Language of messages and the summary: en or ru (default: from LC_ALL, LC_MESSAGES or LANG)")
+	flag.BoolVar(&noColor, "no-color", false, "Disable colored output (also off when stderr is not a terminal or NO_COLOR is set)")
+	flag.StringVar(&pprofAddr, "pprof", "", "Serve net/http/pprof on this address during the run, e.g. :6060 or localhost:6060")
+	flag.StringVar(&statePath, "state", "translation_state.json", "Path to cue hashes of previous runs for incremental re-translation (empty to disable)")
 }
 
 func main() {
-	if inputPath == "" {
-		fmt.Println("Please specify path with --input and language with --lang")
-		os.Exit(1)
+	// Flags are parsed here rather than in init, so tests can run without
+	// them. Bad flags are a setup error, not the "files failed" exit code 2
+	// the flag package would use.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitSetupError)
+	}
+	initColor()
+	initUILang()
+	if pprofAddr != "" {
+		if err := startPprof(pprofAddr); err != nil {
+			statusln(err)
+			os.Exit(exitSetupError)
+		}
+	}
+	if err := resolveSecrets(); err != nil {
+		statusln(err)
+		os.Exit(exitSetupError)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			statusf("⚠️ %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		return
 	}
 
+	if inputPath == "" && inputList == "" {
+		statusln("Please specify path with --input and language with --lang")
+		os.Exit(exitSetupError)
+	}
+	if inputPath != "" && inputList != "" {
+		statusln("--input and --input-list cannot be used together")
+		os.Exit(exitSetupError)
+	}
 	var err error
+	var listed []string
+	if inputList != "" {
+		if listed, err = readInputList(inputList); err != nil {
+			statusf("Invalid --input-list: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+	} else if inputPath, err = resolvePath(inputPath); err != nil {
+		statusf("Invalid --input path: %v\n", err)
+		os.Exit(exitSetupError)
+	}
+	if outputDir, err = resolvePath(outputDir); err != nil {
+		statusf("Invalid --output-dir path: %v\n", err)
+		os.Exit(exitSetupError)
+	}
+
+	targetLangs = parseLangs(targetLang)
+	if len(targetLangs) == 0 {
+		statusln("Please specify at least one target language with --lang")
+		os.Exit(exitSetupError)
+	}
+	if err := checkLangCodes(targetLangs); err != nil {
+		statusln(fmt.Errorf("--lang: %w", err))
+		os.Exit(exitSetupError)
+	}
+
+	switch chapterMode {
+	case "auto", "on", "off":
+	default:
+		statusf("Invalid --chapters value %q, expected auto, on or off\n", chapterMode)
+		os.Exit(exitSetupError)
+	}
+
+	if timeScale <= 0 {
+		statusf("Invalid --scale value %v, must be positive\n", timeScale)
+		os.Exit(exitSetupError)
+	}
+	if minGap < 0 || maxDuration < 0 {
+		statusln("--min-gap and --max-duration must not be negative")
+		os.Exit(exitSetupError)
+	}
+	if mergeShort < 0 || mergeChars < 0 || mergeGap < 0 {
+		statusln("--merge-short, --merge-chars and --merge-gap must not be negative")
+		os.Exit(exitSetupError)
+	}
+
+	switch outputFormat {
+	case "", formatSRT, formatVTT:
+	default:
+		statusf("Invalid --output-format value %q, expected srt or vtt\n", outputFormat)
+		os.Exit(exitSetupError)
+	}
+	if spellCheck {
+		if _, err := exec.LookPath("hunspell"); err != nil {
+			statusln("--spellcheck needs hunspell in PATH")
+			os.Exit(exitSetupError)
+		}
+	}
+	if styleGuide != "" {
+		rules, err := loadStyleGuide(styleGuide)
+		if err != nil {
+			statusln(err)
+			os.Exit(exitSetupError)
+		}
+		styleGuideRules = rules
+	}
+	if err := selectProvider(); err != nil {
+		statusln(err)
+		os.Exit(exitSetupError)
+	}
+	if err := validateLanguages(sourceLang, targetLangs); err != nil {
+		statusln(err)
+		os.Exit(exitSetupError)
+	}
+	if llmTemperature < 0 || llmMaxTokens < 0 || llmContextWindow < 0 {
+		statusln("--temperature, --max-tokens and --context-window must not be negative")
+		os.Exit(exitSetupError)
+	}
+	if err := loadPromptSettings(targetLangs); err != nil {
+		statusf("Failed to load prompt settings: %v\n", err)
+		os.Exit(exitSetupError)
+	}
+	if retryWorkers < 0 {
+		statusln("--retry-workers must be >= 0")
+		os.Exit(exitSetupError)
+	}
+	if maxErrors < 0 || maxErrorRate < 0 || maxErrorRate > 1 {
+		statusln("--max-errors must be >= 0 and --max-error-rate between 0 and 1")
+		os.Exit(exitSetupError)
+	}
+	for _, attr := range strings.Split(preserveList, ",") {
+		switch attr = strings.TrimSpace(attr); attr {
+		case "":
+		case "mode", "mtime", "owner":
+			preserve[attr] = true
+		default:
+			statusf("Invalid --preserve value %q, expected mode, mtime or owner\n", attr)
+			os.Exit(exitSetupError)
+		}
+	}
+	if forceOverwrite && skipExisting {
+		statusln("--force and --skip-existing cannot be combined")
+		os.Exit(exitSetupError)
+	}
+	if maxInflightLines < 0 {
+		statusln("--max-inflight-lines must be >= 0")
+		os.Exit(exitSetupError)
+	}
+	if maxInflightLines > 0 {
+		inflightLines = semaphore.NewWeighted(int64(maxInflightLines))
+	}
+	if inputFPS < 0 || outputFPS < 0 {
+		statusln("Frame rates must be positive")
+		os.Exit(exitSetupError)
+	}
+
 	errorLog, err = os.OpenFile("translate_errors.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		fmt.Printf("Failed to open error log file: %v\n", err)
-		os.Exit(1)
+		statusf("Failed to open error log file: %v\n", err)
+		os.Exit(exitSetupError)
 	}
 	defer func() {
 		if err := errorLog.Close(); err != nil {
-			fmt.Printf("⚠️ Failed to close error log: %v", err)
+			statusf("⚠️ Failed to close error log: %v", err)
 		}
 	}()
 
-	info, err := os.Stat(inputPath)
-	if err != nil {
-		logError(fmt.Sprintf("Access error: %v", err))
-		os.Exit(1)
+	var info os.FileInfo
+	if listed == nil {
+		if info, err = os.Stat(inputPath); err != nil {
+			logError(fmt.Sprintf("Access error: %v", err))
+			os.Exit(exitSetupError)
+		}
+	}
+
+	if cachePath != "" {
+		loaded, err := loadCache(cachePath)
+		if err != nil {
+			logError(fmt.Sprintf("Failed to load cache: %v", err))
+			os.Exit(exitSetupError)
+		}
+		if loaded > 0 {
+			statusf("🧠 Loaded %d cached translations from %s\n", loaded, cachePath)
+		}
+	}
+
+	if statePath != "" {
+		if err := loadState(statePath); err != nil {
+			logError(fmt.Sprintf("Failed to load state: %v", err))
+			os.Exit(exitSetupError)
+		}
 	}
 
 	start := time.Now()
 
-	if info.IsDir() {
+	if listed != nil {
+		inputRoot = commonDir(listed)
+		totalLines := 0
+		for _, path := range listed {
+			// Missing files are reported when they are processed
+			if _, err := os.Stat(path); err == nil {
+				totalLines += countLines(path)
+			}
+		}
+		globalBar = progressbar.NewOptions(totalLines*len(targetLangs),
+			progressbar.OptionSetDescription("Total Progress"),
+			progressbar.OptionShowCount(),
+			progressbar.OptionShowIts(),
+			progressbar.OptionSetPredictTime(true),
+			progressbar.OptionFullWidth(),
+			progressbar.OptionSetWriter(barOut))
+		var errs []error
+		for _, lang := range targetLangs {
+			errs = append(errs, processFileList(listed, lang))
+		}
+		err = errors.Join(errs...)
+	} else if info.IsDir() {
+		inputRoot = inputPath
 		// Pre-count total lines for global progress bar
-		totalLines := countTotalLines(inputPath)
+		totalLines := countTotalLines(inputPath) * len(targetLangs)
 		globalBar = progressbar.NewOptions(totalLines,
 			progressbar.OptionSetDescription("Total Progress"),
 			progressbar.OptionShowCount(),
 			progressbar.OptionShowIts(),
 			progressbar.OptionSetPredictTime(true),
-			progressbar.OptionFullWidth())
-		err = processDirectory(inputPath, targetLang)
+			progressbar.OptionFullWidth(),
+			progressbar.OptionSetWriter(barOut))
+		var errs []error
+		for _, lang := range targetLangs {
+			errs = append(errs, processDirectory(inputPath, lang))
+		}
+		err = errors.Join(errs...)
 	} else {
+		inputRoot = filepath.Dir(inputPath)
 		globalBar = progressbar.NewOptions(1,
 			progressbar.OptionSetDescription("Progress"),
 			progressbar.OptionShowCount(),
 			progressbar.OptionShowIts(),
 			progressbar.OptionSetPredictTime(true),
-			progressbar.OptionFullWidth())
-		err = processFile(inputPath, targetLang)
+			progressbar.OptionFullWidth(),
+			progressbar.OptionSetWriter(barOut))
+		var errs []error
+		for _, lang := range targetLangs {
+			if err := processFile(inputPath, lang); err != nil && !errors.Is(err, errTooManyErrors) {
+				errs = append(errs, fmt.Errorf("%s [%s]: %w", inputPath, lang, err))
+			}
+		}
+		err = errors.Join(errs...)
+	}
+
+	if aborted() == nil {
+		if retryErr := retryDeferred(); retryErr != nil {
+			err = errors.Join(err, retryErr)
+		}
 	}
 
 	duration := time.Since(start)
-	fmt.Printf("\n✅ Completed: %d files, %d lines in %v\n", fileCounter, lineCounter, duration)
+	statusf("\n%s\n", colorize(colorGreen, fmt.Sprintf(tr("✅ Completed: %d files, %d lines in %v"), fileCounter, lineCounter, duration)))
+	printLineStats()
+	statusf("🧠 Cache: %s\n", cacheSummary())
+	if styleGuideRules != nil {
+		statusf("📏 Style guide %s: %d of %d cues compliant\n", styleGuide, styleCueCounter-styleFailedCounter, styleCueCounter)
+	}
+	if spellCheck || styleGuideRules != nil {
+		if issues, err := writeQualityReport(qualityReport); err != nil {
+			logError(fmt.Sprintf("Failed to write quality report: %v", err))
+		} else {
+			statusf("🔎 Quality report: %d issue(s) in %s\n", issues, qualityReport)
+		}
+	}
+	if postEditedCounter > 0 {
+		statusf("✍️ Post-edited %d cues with the LLM\n", postEditedCounter)
+	}
+	if skippedFileCounter > 0 {
+		statusf("⏭️ Skipped %d file(s) with existing outputs\n", skippedFileCounter)
+	}
+	if reusedCueCounter > 0 {
+		statusf("♻️ Reused %d unchanged cues from previous outputs\n", reusedCueCounter)
+	}
+	if mergedCueCounter > 0 {
+		statusf("🧩 Merged %d short cues into the cues before them\n", mergedCueCounter)
+	}
+	if fixedTimingCounter > 0 {
+		statusf("⏱️ Shortened %d cues for --min-gap/--max-duration\n", fixedTimingCounter)
+	}
+	if cachePath != "" {
+		if err := saveCache(cachePath); err != nil {
+			logError(fmt.Sprintf("Failed to save cache: %v", err))
+		}
+	}
+	if statePath != "" {
+		if err := saveState(statePath); err != nil {
+			logError(fmt.Sprintf("Failed to save state: %v", err))
+		}
+	}
+	if cause := aborted(); cause != nil {
+		logError(fmt.Sprintf("Run aborted: %v", cause))
+		if err != nil {
+			logError(failureReport(err))
+		}
+		os.Exit(exitAborted)
+	}
 	if err != nil {
-		logError(fmt.Sprintf("Processing error: %v", err))
-		os.Exit(1)
+		logError(failureReport(err))
+		os.Exit(exitFileFailures)
+	}
+	if failedLineCount > 0 {
+		logError(fmt.Sprintf("%d line(s) could not be translated and kept their original text", failedLineCount))
+		os.Exit(exitLineFailures)
+	}
+}
+
+// failureReport lists every per-file error collected during the run.
+func failureReport(err error) string {
+	errs := flattenErrors(err)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d file(s) failed:", len(errs))
+	for _, e := range errs {
+		sb.WriteString("\n  - " + e.Error())
+	}
+	return sb.String()
+}
+
+// flattenErrors unpacks (nested) errors.Join results into single errors.
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
 	}
+	return errs
+}
+
+// parseLangs splits the comma-separated --lang value.
+func parseLangs(list string) []string {
+	var langs []string
+	for _, lang := range strings.Split(list, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// checkLangCodes accepts only plain language codes such as ru or pt-BR:
+// codes become directory and file names of outputs, so "../x" would write
+// outside --output-dir.
+func checkLangCodes(langs []string) error {
+	invalid := func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}
+	for _, lang := range langs {
+		if strings.IndexFunc(lang, invalid) >= 0 {
+			return fmt.Errorf("%q is not a language code", lang)
+		}
+	}
+	return nil
 }
 
 func isSubtitleFile(name string) bool {
 	lower := strings.ToLower(name)
-	return strings.HasSuffix(lower, ".vtt") || strings.HasSuffix(lower, ".srt")
+	// Outputs of this tool (example_ru.vtt) are not sources
+	base := strings.TrimSuffix(lower, filepath.Ext(lower))
+	for _, lang := range targetLangs {
+		if strings.HasSuffix(base, "_"+strings.ToLower(lang)) {
+			return false
+		}
+	}
+	switch subtitleFormat(lower) {
+	case formatVTT, formatSRT, formatMicroDVD, formatJSON, formatJSON3, formatSRV3:
+		return true
+	}
+	return false
 }
 
 func countTotalLines(root string) int {
 	var total int64
 	errWalk := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && isOutputDir(path) {
+			return filepath.SkipDir
+		}
 		if err == nil && !info.IsDir() && !strings.HasPrefix(info.Name(), ".") && isSubtitleFile(info.Name()) {
-			f, err := os.Open(path)
-			if err == nil {
-				scanner := bufio.NewScanner(f)
-				for scanner.Scan() {
-					total++
-				}
-				if closeErr := f.Close(); closeErr != nil {
-					logError(fmt.Sprintf("Failed to close file %s: %v", path, closeErr))
-				}
-			} else {
-				logError(fmt.Sprintf("Failed to open file %s: %v", path, err))
-			}
+			total += int64(countLines(path))
 		}
 		return nil
 	})
@@ -138,139 +571,442 @@ func countTotalLines(root string) int {
 	return int(total)
 }
 
+// processDirectory translates every subtitle file under dirPath with up to
+// `workers` files in flight. A failing file does not stop the others: all
+// failures are collected and returned together once the walk is done.
 func processDirectory(dirPath, lang string) error {
-	var wg sync.WaitGroup
-	sem := semaphore.NewWeighted(int64(workers))
+	batch := newFileBatch(lang)
+	// Other JSON files, such as a translation cache, may share the directory
+	batch.skipOther = true
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	walkErr := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			logError(fmt.Sprintf("Walk error %s: %v", path, err))
+			batch.fail(fmt.Errorf("%s: %w", path, err))
 			return nil
 		}
+		if info.IsDir() && isOutputDir(path) {
+			return filepath.SkipDir
+		}
+		if aborted() != nil {
+			return filepath.SkipAll
+		}
 
 		if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") && isSubtitleFile(info.Name()) {
-			wg.Add(1)
-			if err := sem.Acquire(context.Background(), 1); err != nil {
-				logError(fmt.Sprintf("Semaphore error: %v", err))
-				wg.Done()
-				return nil
+			if !batch.add(path) {
+				return filepath.SkipAll
 			}
-
-			go func(p string) {
-				defer wg.Done()
-				defer sem.Release(1)
-				defer func() {
-					if r := recover(); r != nil {
-						logError(fmt.Sprintf("Panic in file %s: %v", p, r))
-					}
-				}()
-
-				if err := processFile(p, lang); err != nil {
-					logError(fmt.Sprintf("Translation error %s: %v", p, err))
-				}
-			}(path)
 		}
 		return nil
 	})
 
-	wg.Wait()
+	err := batch.wait()
+	if walkErr != nil {
+		err = errors.Join(err, walkErr)
+	}
 	return err
 }
 
+// fileBatch translates files into one language with up to `workers` files
+// in flight, collecting the failures instead of stopping at the first.
+type fileBatch struct {
+	g    errgroup.Group
+	lang string
+	// skipOther ignores .json, .srv3 and .sub files that turn out not to be
+	// captions
+	skipOther bool
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func newFileBatch(lang string) *fileBatch {
+	b := &fileBatch{lang: lang}
+	b.g.SetLimit(workers)
+	return b
+}
+
+func (b *fileBatch) fail(err error) {
+	b.mu.Lock()
+	b.errs = append(b.errs, err)
+	b.mu.Unlock()
+	atomic.AddInt64(&failedFileCount, 1)
+	checkErrorBudget()
+}
+
+// add schedules a file, waiting for a free worker and until its lines fit
+// under --max-inflight-lines. It reports false once the run is aborted.
+func (b *fileBatch) add(path string) bool {
+	weight := int64(0)
+	if inflightLines != nil {
+		weight = min(int64(countLines(path)), int64(maxInflightLines))
+		if !b.acquireLines(weight) {
+			return false
+		}
+	}
+	b.g.Go(func() error {
+		defer func() {
+			if weight > 0 {
+				inflightLines.Release(weight)
+			}
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				logError(fmt.Sprintf("Panic in file %s: %v", path, r))
+				b.fail(fmt.Errorf("%s: panic: %v", path, r))
+			}
+		}()
+
+		err := processFile(path, b.lang)
+		if err == nil && weight > 0 && holdForRetry(path, b.lang, weight) {
+			weight = 0
+		}
+		if b.skipOther && errors.Is(err, errNotCaptions) {
+			return nil
+		}
+		if errors.Is(err, errTooManyErrors) {
+			// Unfinished because of the abort, not a failure of its own
+			return nil
+		}
+		if err != nil {
+			logError(fmt.Sprintf("Translation error %s: %v", path, err))
+			b.fail(fmt.Errorf("%s [%s]: %w", path, b.lang, err))
+		}
+		return nil
+	})
+	return true
+}
+
+// acquireLines waits until weight more lines fit under --max-inflight-lines.
+// Deferred files keep their lines counted until the retry pass writes them,
+// so when only they could make room, the retry pass runs early.
+func (b *fileBatch) acquireLines(weight int64) bool {
+	for {
+		held, queued := heldForRetry()
+		if inflightLines.TryAcquire(weight) {
+			return true
+		}
+		if held > 0 && held+weight > int64(maxInflightLines) {
+			if err := retryDeferred(); err != nil {
+				if aborted() != nil {
+					return false
+				}
+				b.fail(err)
+			}
+			continue
+		}
+		// Wait for running files, unless one of them gets deferred meanwhile
+		ctx, cancel := context.WithCancel(runCtx)
+		go func() {
+			select {
+			case <-queued:
+			case <-ctx.Done():
+			}
+			cancel()
+		}()
+		err := inflightLines.Acquire(ctx, weight)
+		cancel()
+		if err == nil {
+			return true
+		}
+		if runCtx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// wait blocks until every scheduled file is done and returns all failures.
+func (b *fileBatch) wait() error {
+	_ = b.g.Wait()
+	return errors.Join(b.errs...)
+}
+
+// textLine is one line of a block waiting for translation; the part of the
+// line before offset is kept as is.
+type textLine struct {
+	b      *block
+	i      int
+	offset int
+}
+
 func processFile(inputPath, lang string) error {
-	file, err := os.Open(inputPath)
+	doc, lineCount, err := readSubtitle(inputPath, inputFPS)
 	if err != nil {
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			logError(fmt.Sprintf("Failed to close file %s: %v", inputPath, err))
+
+	format := subtitleFormat(inputPath)
+
+	if outputFPS > 0 {
+		sourceFPS := inputFPS
+		if doc.fps > 0 {
+			sourceFPS = doc.fps
+		}
+		if sourceFPS == 0 {
+			return fmt.Errorf("--output-fps needs --input-fps for %s files", format)
 		}
-	}(file)
+		doc.retime(0, sourceFPS/outputFPS)
+	}
+	doc.retime(timeShift, timeScale)
+	if mergeShort > 0 || mergeChars > 0 {
+		atomic.AddInt64(&mergedCueCounter, int64(doc.mergeShortCues(mergeShort, mergeChars, mergeGap)))
+	}
+	atomic.AddInt64(&fixedTimingCounter, int64(doc.fixTiming(minGap, maxDuration)))
+
+	outFormat := outputFormat
+	if outFormat == "" {
+		outFormat = format
+		if format == formatMicroDVD {
+			outFormat = formatSRT
+		}
+	}
+	if outFormat != format {
+		doc.convertTo(outFormat)
+	}
+	outputPath := getOutputPath(inputPath, lang, outFormat)
+	skip, err := skipExistingOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	if skip {
+		_ = globalBar.Add(lineCount)
+		atomic.AddInt64(&skippedFileCounter, 1)
+		return nil
+	}
+	stats := newFileStats(inputPath, lang)
 
-	scanner := bufio.NewScanner(file)
-	type indexedLine struct {
-		index int
-		text  string
+	cues := doc.cues()
+	hashes := make([]string, len(cues))
+	for i, cue := range cues {
+		hashes[i] = cue.hash()
+	}
+	var reused map[*block]bool
+	if statePath != "" {
+		reused = patchFromPreviousOutput(doc, hashes, outputPath)
+		atomic.AddInt64(&reusedCueCounter, int64(len(reused)))
 	}
 
-	var lines []indexedLine
-	index := 0
+	headerLines := 0
+	for _, b := range doc.blocks {
+		if b.kind == blockHeader {
+			updateHeader(b, lang, translateHeader, func(text string) (string, error) {
+				translated, cached, err := translateText(text, lang)
+				if err == nil {
+					stats.done(cached)
+					headerLines++
+				}
+				return translated, err
+			})
+		}
+	}
 
-	for scanner.Scan() {
-		text := scanner.Text()
-		lines = append(lines, indexedLine{index: index, text: text})
-		index++
+	chapters := chapterMode == "on" || chapterMode == "auto" && doc.isChapterTrack(inputPath)
+
+	var pending []textLine
+	var edits []postEditCue
+	for _, b := range doc.blocks {
+		if reused[b] {
+			continue
+		}
+		// Chapter titles are translated, JSON chapter metadata is kept as is
+		if chapters && b.kind == blockCue && b.isJSONPayload() {
+			continue
+		}
+		// NOTE comments are kept verbatim unless asked otherwise
+		if b.kind == blockNote && !translateNotes {
+			continue
+		}
+		translated := false
+		for i := range b.lines {
+			if offset, ok := b.translatableText(i); ok {
+				pending = append(pending, textLine{b: b, i: i, offset: offset})
+				translated = true
+			}
+		}
+		if postEdit && translated && b.kind == blockCue {
+			edits = append(edits, postEditCue{cue: b, source: append([]string(nil), b.lines...)})
+		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+	// Service lines, blank lines and reused cues are done already
+	if done := lineCount - len(pending); done > 0 {
+		_ = globalBar.Add(done)
+		stats.skipped = int64(done - headerLines)
 	}
 
-	results := make([]string, len(lines))
 	var wg sync.WaitGroup
 	sem := semaphore.NewWeighted(int64(workers))
+	var transientMu sync.Mutex
+	var transient []textLine
 
-	for _, line := range lines {
+	for _, line := range pending {
 		wg.Add(1)
-		if err := sem.Acquire(context.Background(), 1); err != nil {
-			logError(fmt.Sprintf("Line semaphore error: %v", err))
+		if err := sem.Acquire(runCtx, 1); err != nil {
+			// Run aborted: stop starting new lines
 			wg.Done()
-			continue
+			break
 		}
 
-		go func(l indexedLine) {
+		go func(l textLine) {
 			defer wg.Done()
 			defer sem.Release(1)
 
-			// Skipping subtitle service lines
-			if strings.Contains(l.text, "-->") || strings.TrimSpace(l.text) == "" || l.text == "WEBVTT" {
-				results[l.index] = l.text
-				_ = globalBar.Add(1)
+			line := l.b.lines[l.i]
+			translated, cached, err := translateText(line[l.offset:], lang)
+			if err != nil && aborted() != nil {
+				// Cancelled by the abort, the file is not written anyway
 				return
 			}
-
-			translated, err := translateText(l.text, lang)
 			if err != nil {
-				logError(fmt.Sprintf("Line error in file '%s' [line %d]: '%s' — %v", inputPath, l.index+1, l.text, err))
-				results[l.index] = l.text // Сохраняем оригинал при ошибке
+				logError(fmt.Sprintf("Line error in file '%s' [line %d]: '%s' — %v", inputPath, l.b.lineNo+l.i, line, err))
+				// Keep the original line on error, transient failures get another chance at the end
+				if retryWorkers > 0 && isTransient(err) {
+					transientMu.Lock()
+					transient = append(transient, l)
+					transientMu.Unlock()
+				}
+				atomic.AddInt64(&failedLineCount, 1)
+				stats.lineFailed(l.b)
+				checkErrorBudget()
 			} else {
-				results[l.index] = translated
+				l.b.lines[l.i] = line[:l.offset] + translated
 				atomic.AddInt64(&lineCounter, 1)
+				stats.done(cached)
 			}
 			_ = globalBar.Add(1)
 		}(line)
 	}
 
 	wg.Wait()
-	output := strings.Join(results, "\n")
-	outputPath := getOutputPath(inputPath, lang)
+	if err := aborted(); err != nil {
+		// Never leave a half-translated file behind
+		return err
+	}
+	if len(transient) > 0 {
+		deferFile(&deferredFile{
+			inputPath:  inputPath,
+			outputPath: outputPath,
+			lang:       lang,
+			doc:        doc,
+			hashes:     hashes,
+			lines:      transient,
+			edits:      edits,
+			stats:      stats,
+		})
+		return nil
+	}
+	if edits = translatedEdits(edits, stats); len(edits) > 0 {
+		postEditCues(edits, lang, inputPath)
+	}
+	return writeOutput(doc, inputPath, outputPath, lang, translatedHashes(doc, hashes, stats))
+}
+
+// renderedCues parses rendered output back and counts its cues.
+func renderedCues(doc *subtitle, output string) int {
+	if doc.captions != nil {
+		format := formatJSON
+		if _, ok := doc.captions.(*srv3Captions); ok {
+			format = formatSRV3
+		}
+		parsed, err := parseCaptionDocument(format, []byte(output))
+		if err != nil {
+			return 0
+		}
+		return len(parsed.cues())
+	}
+	return len(parseSubtitle(splitLines(output)).cues())
+}
+
+func writeOutput(doc *subtitle, inputPath, outputPath, lang string, hashes []string) error {
+	if spellCheck {
+		if err := checkSpelling(doc, outputPath, lang); err != nil {
+			logError(fmt.Sprintf("Spell check error %s: %v", outputPath, err))
+		}
+	}
+	if styleGuideRules != nil {
+		checkStyle(doc, outputPath)
+	}
+
+	output := doc.render()
+	// Catch text that would change the structure, such as a blank line
+	// inside a cue, before it replaces a good file
+	if n := renderedCues(doc, output); n != len(doc.cues()) {
+		return fmt.Errorf("rendered output has %d cues instead of %d, not written", n, len(doc.cues()))
+	}
+	if outputDir != "" {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return err
+		}
+	}
+	source, err := os.Stat(inputPath)
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if preserve["mode"] {
+		perm = source.Mode().Perm()
+	}
+	if err := writeFileAtomic(outputPath, []byte(output), perm); err != nil {
+		return err
+	}
 	atomic.AddInt64(&fileCounter, 1)
-	return os.WriteFile(outputPath, []byte(output), 0644)
+	if err := preserveAttributes(source, outputPath); err != nil {
+		logError(fmt.Sprintf("Failed to preserve attributes of %s on %s: %v", inputPath, outputPath, err))
+	}
+	if statePath != "" {
+		cueState.record(outputPath, hashes)
+	}
+	return nil
 }
 
-func translateText(text, lang string) (string, error) {
+// translateText translates one line, reporting whether it came from the cache.
+func translateText(text, lang string) (string, bool, error) {
 	text = strings.TrimSpace(text)
-	if val, ok := translationCache.Load(text); ok {
-		return val.(string), nil
+	key := cacheKey{engine: cacheEngine(), source: sourceLang, target: lang, text: text}
+	if translated, ok := lookupCache(key); ok {
+		return translated, true, nil
+	}
+
+	translated, err := provider.translate(text, sourceLang, lang)
+	if err != nil {
+		return "", false, err
 	}
 
+	storeCache(key, translated)
+	return translated, false, nil
+}
+
+// libreTranslateProvider talks to the instance at translateURL, or to the
+// instances of an --endpoints config file.
+type libreTranslateProvider struct {
+	endpoints *endpointPool
+}
+
+func (p libreTranslateProvider) translate(text, source, target string) (string, error) {
+	url := translateURL
 	req := TranslateRequest{
 		Q:      text,
-		Source: "en",
-		Target: lang,
+		Source: source,
+		Target: target,
 		Format: "text",
 	}
+	if p.endpoints != nil {
+		e, err := p.endpoints.acquire(source, target)
+		if err != nil {
+			return "", err
+		}
+		defer p.endpoints.release(e)
+		url, req.APIKey = e.URL, e.APIKey
+	}
 
 	body, err := json.Marshal(req)
 	if err != nil {
 		return "", err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(runCtx, 10*time.Second)
 	defer cancel()
 
-	reqHTTP, err := http.NewRequestWithContext(ctx, "POST", translateURL, bytes.NewBuffer(body))
+	reqHTTP, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return "", err
 	}
@@ -288,7 +1024,7 @@ func translateText(text, lang string) (string, error) {
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API response: %s", resp.Status)
+		return "", &apiStatusError{code: resp.StatusCode, status: resp.Status}
 	}
 
 	var res TranslateResponse
@@ -296,19 +1032,109 @@ func translateText(text, lang string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-
-	translationCache.Store(text, res.TranslatedText)
 	return res.TranslatedText, nil
 }
 
-func getOutputPath(inputPath, lang string) string {
+func (p libreTranslateProvider) languages() ([]language, error) {
+	if p.endpoints != nil {
+		return p.endpoints.languages()
+	}
+	return libreTranslateLanguages(translateURL)
+}
+
+// libreTranslateLanguages queries LibreTranslate's /languages endpoint,
+// next to /translate.
+func libreTranslateLanguages(endpointURL string) ([]language, error) {
+	ctx, cancel := context.WithTimeout(runCtx, 10*time.Second)
+	defer cancel()
+
+	url := strings.TrimSuffix(endpointURL, "translate") + "languages"
+	reqHTTP, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(reqHTTP)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to close response body: %v", err))
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	var langs []language
+	if err := json.NewDecoder(resp.Body).Decode(&langs); err != nil {
+		return nil, err
+	}
+	return langs, nil
+}
+
+func getOutputPath(inputPath, lang, format string) string {
 	ext := filepath.Ext(inputPath)
 	base := strings.TrimSuffix(inputPath, ext)
-	return base + "_" + lang + ext
+	if subtitleFormat(inputPath) != format {
+		ext = "." + format
+	}
+	if outputDir == "" {
+		return base + "_" + lang + ext
+	}
+
+	// <output-dir>/<lang>/<path relative to the input root>, no suffix
+	rel, err := filepath.Rel(inputRoot, base)
+	if err != nil {
+		rel = filepath.Base(base)
+	}
+	return filepath.Join(outputDir, lang, rel) + ext
+}
+
+// countLines counts the lines of a file without keeping it in memory. JSON
+// and srv3 captions count their cue lines, as that is what their progress
+// is made of.
+func countLines(path string) int {
+	if subtitleFormat(path) == formatMicroDVD && isVobSub(path) {
+		return 0
+	}
+	if isCaptionDocument(path) {
+		_, n, err := readSubtitle(path, 0)
+		if err != nil && !errors.Is(err, errNotCaptions) {
+			logError(fmt.Sprintf("Failed to read file %s: %v", path, err))
+		}
+		return n
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to open file %s: %v", path, err))
+		return 0
+	}
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	if closeErr := f.Close(); closeErr != nil {
+		logError(fmt.Sprintf("Failed to close file %s: %v", path, closeErr))
+	}
+	return n
+}
+
+// isOutputDir reports whether a directory met while walking the input is the
+// --output-dir tree, which must not be translated again.
+func isOutputDir(path string) bool {
+	if outputDir == "" {
+		return false
+	}
+	a, errA := filepath.Abs(path)
+	b, errB := filepath.Abs(outputDir)
+	return errA == nil && errB == nil && samePath(a, b)
 }
 
 func logError(message string) {
-	fmt.Println("⚠️", message)
+	statusln(colorize(colorRed, "⚠️ "+message))
 	_, err := errorLog.WriteString(message + "\n")
 	if err != nil {
 		return
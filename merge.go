@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runMergeCommand combines two language tracks of the same video into one
+// dual-language subtitle: `merge [--output file] original.vtt translated.vtt`.
+func runMergeCommand(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	output := fs.String("output", "", "Output file (default: <first>_dual.<ext>, - for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: merge [--output file] <first> <second>")
+	}
+
+	first, _, err := readSubtitle(fs.Arg(0), inputFPS)
+	if err != nil {
+		return err
+	}
+	second, _, err := readSubtitle(fs.Arg(1), inputFPS)
+	if err != nil {
+		return err
+	}
+
+	outPath := *output
+	if outPath == "" {
+		ext := filepath.Ext(fs.Arg(0))
+		outPath = strings.TrimSuffix(fs.Arg(0), ext) + "_dual"
+		if f := subtitleFormat(fs.Arg(0)); f != formatSRT && f != formatVTT {
+			ext = "." + formatSRT
+		}
+		outPath += ext
+	}
+	format := subtitleFormat(outPath)
+	if outPath == "-" {
+		format = subtitleFormat(fs.Arg(0))
+	}
+	if format != formatSRT && format != formatVTT {
+		format = formatSRT
+	}
+
+	merged := mergeSubtitles(first, second)
+	merged.convertTo(format)
+	if outPath == "-" {
+		_, err = os.Stdout.WriteString(merged.render())
+		return err
+	}
+	if err := writeFileAtomic(outPath, []byte(merged.render()), 0644); err != nil {
+		return err
+	}
+	statusf("🔀 Merged %d + %d cues into %d cues: %s\n", len(first.cues()), len(second.cues()), len(merged.cues()), outPath)
+	return nil
+}
+
+// mergeSubtitles aligns the cues of second to the cues of first by time.
+// Each cue of second goes to the cue of first it overlaps most and its lines
+// are appended there; cues that overlap nothing are kept as cues of their own.
+// Non-cue blocks (header, styles, notes) of first are preserved.
+func mergeSubtitles(first, second *subtitle) *subtitle {
+	firstCues := first.cues()
+	attached := make(map[*block][]*block)
+	var unmatched []*block
+
+	for _, cue := range second.cues() {
+		var best *block
+		var bestOverlap time.Duration
+		for _, candidate := range firstCues {
+			if overlap := cueOverlap(candidate, cue); overlap > bestOverlap {
+				best, bestOverlap = candidate, overlap
+			}
+		}
+		if best == nil {
+			unmatched = append(unmatched, cue)
+			continue
+		}
+		attached[best] = append(attached[best], cue)
+	}
+
+	merged := &subtitle{newline: first.newline}
+	// Unmatched cues are slotted in before the first cue that starts later
+	emitUnmatched := func(before time.Duration, all bool) {
+		for len(unmatched) > 0 && (all || unmatched[0].times.start < before) {
+			cue := *unmatched[0]
+			cue.id = ""
+			merged.blocks = append(merged.blocks, &cue)
+			unmatched = unmatched[1:]
+		}
+	}
+
+	for _, b := range first.blocks {
+		if b.kind != blockCue {
+			merged.blocks = append(merged.blocks, b)
+			continue
+		}
+		emitUnmatched(b.times.start, false)
+		cue := *b
+		cue.lines = append([]string(nil), b.lines...)
+		for _, other := range attached[b] {
+			cue.lines = append(cue.lines, other.lines...)
+		}
+		merged.blocks = append(merged.blocks, &cue)
+	}
+	emitUnmatched(0, true)
+	return merged
+}
+
+func cueOverlap(a, b *block) time.Duration {
+	start := max(a.times.start, b.times.start)
+	end := min(a.times.end, b.times.end)
+	return end - start
+}
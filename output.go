@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// statusOut receives the progress bar and status messages, so stdout only
+// carries what a command produces (exported cache, merged subtitles, tables)
+// and can be piped.
+var statusOut io.Writer = os.Stderr
+
+// barOut carries the progress bar to statusOut. It is held while a
+// question waits for an answer, so redraws for other files do not garble
+// the prompt.
+var barOut = &barWriter{}
+
+type barWriter struct {
+	mu   sync.Mutex
+	held bool
+}
+
+func (w *barWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.held {
+		return len(p), nil
+	}
+	return statusOut.Write(p)
+}
+
+func (w *barWriter) hold(held bool) {
+	w.mu.Lock()
+	w.held = held
+	w.mu.Unlock()
+}
+
+// statusf and statusln print in the UI language: formats and plain string
+// arguments are looked up with tr.
+func statusf(format string, a ...any) {
+	_, _ = fmt.Fprintf(statusOut, tr(format), a...)
+}
+
+func statusln(a ...any) {
+	for i, v := range a {
+		if s, ok := v.(string); ok {
+			a[i] = tr(s)
+		}
+	}
+	_, _ = fmt.Fprintln(statusOut, a...)
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// useColor is set when stderr is a terminal, unless --no-color or the
+// NO_COLOR convention (https://no-color.org) turn it off.
+var useColor bool
+
+func initColor() {
+	f, ok := statusOut.(*os.File)
+	useColor = !noColor && os.Getenv("NO_COLOR") == "" && ok && term.IsTerminal(int(f.Fd()))
+}
+
+func colorize(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// chownLike is a no-op where files have no Unix owner; on Windows the
+// output inherits the ACL of its directory.
+func chownLike(source os.FileInfo, path string) error {
+	return nil
+}
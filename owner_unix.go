@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike gives path the owner and group of source. Without privileges
+// only the group can be changed, to one the user belongs to.
+func chownLike(source os.FileInfo, path string) error {
+	st, ok := source.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return os.Chown(path, -1, int(st.Gid))
+	}
+	return os.Chown(path, int(st.Uid), int(st.Gid))
+}
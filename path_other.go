@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import "path/filepath"
+
+// resolvePath keeps paths as given; only Windows needs them absolute.
+func resolvePath(path string) (string, error) {
+	return path, nil
+}
+
+func samePath(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath makes a path from the command line absolute. This resolves
+// drive-relative paths such as `D:shows` against the current directory of
+// that drive, and lets the os package add the \\?\ prefix that lifts the
+// MAX_PATH limit, which it only does for absolute paths. UNC shares
+// (\\server\share\dir) are kept as they are.
+func resolvePath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	return filepath.Abs(path)
+}
+
+// samePath compares paths the way the file system does, ignoring case.
+func samePath(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// startPprof serves the net/http/pprof handlers on --pprof for the lifetime
+// of the process. Listening happens up front so a taken port fails the run
+// before any work starts.
+func startPprof(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("--pprof: %w", err)
+	}
+	statusf("🩺 pprof: http://%s/debug/pprof/\n", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, nil); err != nil {
+			logError(fmt.Sprintf("pprof server stopped: %v", err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// translationProvider is a machine translation backend chosen with --provider.
+type translationProvider interface {
+	translate(text, source, target string) (string, error)
+	languages() ([]language, error)
+}
+
+var provider translationProvider = libreTranslateProvider{}
+
+func selectProvider() error {
+	switch providerName {
+	case "libretranslate":
+		var pool *endpointPool
+		if endpointsPath != "" {
+			var err error
+			if pool, err = loadEndpoints(endpointsPath); err != nil {
+				return err
+			}
+			for _, lang := range targetLangs {
+				if !pool.serves(sourceLang, lang) {
+					return fmt.Errorf("no endpoint in %s serves %s → %s", endpointsPath, sourceLang, lang)
+				}
+			}
+		}
+		provider = libreTranslateProvider{endpoints: pool}
+	case "ollama":
+		if llmModel == "" {
+			return errors.New("--provider ollama needs --model, e.g. --model qwen2.5")
+		}
+		provider = ollamaProvider{}
+	case "huggingface":
+		if llmModel == "" {
+			return errors.New("--provider huggingface needs --model, e.g. --model Helsinki-NLP/opus-mt-en-ru")
+		}
+		provider = huggingFaceProvider{}
+	default:
+		return fmt.Errorf("unknown --provider %q, expected libretranslate, ollama or huggingface", providerName)
+	}
+	// --model names the model of ollama and huggingface; post-editing only
+	// falls back to it when the provider has no model of its own
+	if postEditModel == "" {
+		postEditModel = "gpt-4o-mini"
+		if providerName == "libretranslate" && llmModel != "" {
+			postEditModel = llmModel
+		}
+	}
+	return nil
+}
+
+const ollamaTranslatePrompt = `You translate subtitles from {source_lang} to {target_lang}. Translate the line the user sends.
+Keep markup tags such as <i> and keep it about as long as the original. Reply with only the translation, without quotes or comments.{glossary}`
+
+type ollamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  map[string]any `json:"options,omitempty"`
+}
+
+// ollamaChunk is one line of Ollama's streamed NDJSON reply.
+type ollamaChunk struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	Error   string      `json:"error"`
+}
+
+// ollamaProvider translates line by line with a local model through the
+// Ollama /api/chat endpoint, reading the streamed reply as it arrives.
+type ollamaProvider struct{}
+
+func (ollamaProvider) translate(text, source, target string) (string, error) {
+	glossary := glossaries[target]
+	if glossary != "" {
+		glossary = "\nAlways use these term translations:\n" + glossary
+	}
+	system := strings.NewReplacer("{source_lang}", source, "{target_lang}", target, "{glossary}", glossary).Replace(ollamaTranslatePrompt)
+
+	options := map[string]any{"temperature": llmTemperature}
+	if llmMaxTokens > 0 {
+		options["num_predict"] = llmMaxTokens
+	}
+	body, err := json.Marshal(ollamaChatRequest{
+		Model: llmModel,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: text},
+		},
+		Stream:  true,
+		Options: options,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, llmTimeout)
+	defer cancel()
+
+	url := strings.TrimRight(ollamaURL, "/") + "/api/chat"
+	reqHTTP, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	reqHTTP.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(reqHTTP)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to close response body: %v", err))
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if strings.Contains(string(detail), "not found") {
+			return "", fmt.Errorf("model %q not found, run `ollama pull %s`", llmModel, llmModel)
+		}
+		return "", &apiStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	done := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", fmt.Errorf("malformed Ollama stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		sb.WriteString(chunk.Message.Content)
+		if chunk.Done {
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if !done {
+		return "", io.ErrUnexpectedEOF
+	}
+	return cleanLLMTranslation(sb.String(), text), nil
+}
+
+func (ollamaProvider) languages() ([]language, error) {
+	return nil, fmt.Errorf("%w: %s translates the languages it was trained on", errNoLanguageList, llmModel)
+}
+
+// cleanLLMTranslation drops what chatty models add around a one-line
+// answer: <think> reasoning blocks, line breaks and quotes that the source
+// line did not have.
+func cleanLLMTranslation(reply, source string) string {
+	if i := strings.Index(reply, "</think>"); i >= 0 {
+		reply = reply[i+len("</think>"):]
+	}
+	reply = strings.TrimSpace(strings.ReplaceAll(reply, "\n", " "))
+	for _, q := range [][2]string{{`"`, `"`}, {"«", "»"}, {"“", "”"}} {
+		quoted := func(s string) bool {
+			return len(s) > len(q[0])+len(q[1]) && strings.HasPrefix(s, q[0]) && strings.HasSuffix(s, q[1])
+		}
+		if quoted(reply) && !quoted(source) {
+			reply = strings.TrimSpace(reply[len(q[0]) : len(reply)-len(q[1])])
+		}
+	}
+	return reply
+}
+
+// nllbCodes maps ISO 639-1 codes to the FLORES-200 codes NLLB models expect.
+var nllbCodes = map[string]string{
+	"en": "eng_Latn",
+	"ru": "rus_Cyrl",
+	"uk": "ukr_Cyrl",
+	"de": "deu_Latn",
+	"fr": "fra_Latn",
+	"es": "spa_Latn",
+	"it": "ita_Latn",
+	"pt": "por_Latn",
+	"pl": "pol_Latn",
+	"nl": "nld_Latn",
+	"tr": "tur_Latn",
+	"ja": "jpn_Jpan",
+	"ko": "kor_Hang",
+	"zh": "zho_Hans",
+	"ar": "arb_Arab",
+	"hi": "hin_Deva",
+	"kk": "kaz_Cyrl",
+	"be": "bel_Cyrl",
+}
+
+type huggingFaceRequest struct {
+	Inputs     string            `json:"inputs"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type huggingFaceResult struct {
+	TranslationText string `json:"translation_text"`
+	GeneratedText   string `json:"generated_text"`
+}
+
+// huggingFaceProvider uses the HuggingFace Inference API or a dedicated
+// Inference Endpoint running a translation model. Multilingual models get
+// the language pair as parameters; pair-specific ones (opus-mt-en-ru) don't
+// need it.
+type huggingFaceProvider struct{}
+
+func (huggingFaceProvider) languageParameters(source, target string) (map[string]string, error) {
+	model := strings.ToLower(llmModel)
+	switch {
+	case strings.Contains(model, "nllb"):
+		src, ok := nllbCodes[source]
+		if !ok {
+			return nil, fmt.Errorf("no NLLB code known for %q", source)
+		}
+		tgt, ok := nllbCodes[target]
+		if !ok {
+			return nil, fmt.Errorf("no NLLB code known for %q", target)
+		}
+		return map[string]string{"src_lang": src, "tgt_lang": tgt}, nil
+	case strings.Contains(model, "m2m100"):
+		return map[string]string{"src_lang": source, "tgt_lang": target}, nil
+	}
+	return nil, nil
+}
+
+func (p huggingFaceProvider) translate(text, source, target string) (string, error) {
+	params, err := p.languageParameters(source, target)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(huggingFaceRequest{Inputs: text, Parameters: params})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, llmTimeout)
+	defer cancel()
+
+	url := strings.ReplaceAll(hfURL, "{model}", llmModel)
+	reqHTTP, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	reqHTTP.Header.Set("Content-Type", "application/json")
+	if token := hfAPIToken(); token != "" {
+		reqHTTP.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(reqHTTP)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to close response body: %v", err))
+		}
+	}(resp.Body)
+
+	// 503 while the model is loading is transient and retried at the end
+	if resp.StatusCode != http.StatusOK {
+		return "", &apiStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	var results []huggingFaceResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", errors.New("HuggingFace response has no results")
+	}
+	if results[0].TranslationText != "" {
+		return results[0].TranslationText, nil
+	}
+	return strings.TrimSpace(results[0].GeneratedText), nil
+}
+
+// languages is only known for NLLB, whose codes are mapped in nllbCodes;
+// other models cover what they were trained on.
+func (huggingFaceProvider) languages() ([]language, error) {
+	if !strings.Contains(strings.ToLower(llmModel), "nllb") {
+		return nil, fmt.Errorf("%w: %s translates the languages it was trained on, see its model card", errNoLanguageList, llmModel)
+	}
+	codes := make([]string, 0, len(nllbCodes))
+	for code := range nllbCodes {
+		codes = append(codes, code)
+	}
+	langs := make([]language, 0, len(codes))
+	for _, code := range codes {
+		langs = append(langs, language{Code: code, Name: nllbCodes[code], Targets: codes})
+	}
+	return langs, nil
+}
+
+func hfAPIToken() string {
+	if hfToken != "" {
+		return hfToken
+	}
+	return os.Getenv("HF_TOKEN")
+}
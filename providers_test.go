@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestCleanLLMTranslation(t *testing.T) {
+	tests := []struct {
+		reply, source, want string
+	}{
+		{"Привет, мир", "Hello, world", "Привет, мир"},
+		{"  Привет,\nмир\n", "Hello, world", "Привет, мир"},
+		{"<think>\nThe user wants Russian.\n</think>\n\nПривет", "Hello", "Привет"},
+		{`"Привет"`, "Hello", "Привет"},
+		{"«Привет»", "Hello", "Привет"},
+		{"“Привет”", "Hello", "Привет"},
+		{`"Привет"`, `"Hello"`, `"Привет"`},
+		{`"`, "Hello", `"`},
+		{`""`, "Hello", `""`},
+		{`Он сказал "да"`, "He said yes", `Он сказал "да"`},
+	}
+	for _, tt := range tests {
+		if got := cleanLLMTranslation(tt.reply, tt.source); got != tt.want {
+			t.Errorf("cleanLLMTranslation(%q, %q) = %q, want %q", tt.reply, tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qualityIssue is one finding of the post-translation checks, reported per
+// cue so it can be found in a player or editor by its start time.
+type qualityIssue struct {
+	file   string
+	at     time.Duration
+	check  string
+	detail string
+}
+
+var (
+	markupTag = regexp.MustCompile(`<[^>]*>`)
+	assTag    = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+var (
+	qualityMu     sync.Mutex
+	qualityIssues []qualityIssue
+)
+
+func reportIssue(file string, cue *block, check, detail string) {
+	qualityMu.Lock()
+	defer qualityMu.Unlock()
+	qualityIssues = append(qualityIssues, qualityIssue{file: file, at: cue.times.start, check: check, detail: detail})
+}
+
+// writeQualityReport writes all findings grouped by file and ordered by time.
+func writeQualityReport(path string) (int, error) {
+	qualityMu.Lock()
+	issues := append([]qualityIssue(nil), qualityIssues...)
+	qualityMu.Unlock()
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].file != issues[j].file {
+			return issues[i].file < issues[j].file
+		}
+		return issues[i].at < issues[j].at
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Quality report: %d issue(s)\n", len(issues))
+	for i, issue := range issues {
+		if i == 0 || issues[i-1].file != issue.file {
+			sb.WriteString("\n" + issue.file + "\n")
+		}
+		fmt.Fprintf(&sb, "  [%s] %s: %s\n", formatTimestamp(issue.at, false, false), issue.check, issue.detail)
+	}
+	return len(issues), writeFileAtomic(path, []byte(sb.String()), 0644)
+}
+
+// plainText strips markup (<i>, <c.yellow>, {\an8}) before text is checked.
+func plainText(line string) string {
+	line = markupTag.ReplaceAllString(line, "")
+	return strings.TrimSpace(assTag.ReplaceAllString(line, ""))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// retryDelay gives a blipping endpoint a moment before the final retry pass.
+const retryDelay = 2 * time.Second
+
+// apiStatusError is a non-200 answer of the translation API.
+type apiStatusError struct {
+	code   int
+	status string
+}
+
+func (e *apiStatusError) Error() string {
+	return "API response: " + e.status
+}
+
+// isTransient reports whether a failed request is worth retrying later:
+// network errors, timeouts, rate limiting and server-side errors.
+func isTransient(err error) bool {
+	var statusErr *apiStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// deferredFile is a translated document held back from writing because some
+// of its lines failed transiently; it is written after the retry pass.
+type deferredFile struct {
+	inputPath  string
+	outputPath string
+	lang       string
+	doc        *subtitle
+	hashes     []string
+	lines      []textLine
+	edits      []postEditCue
+	stats      *fileStats
+	weight     int64 // --max-inflight-lines weight held until it is written
+}
+
+var (
+	retryMu    sync.Mutex
+	retryQueue []*deferredFile
+	// retryQueued is closed and replaced whenever a file is deferred or
+	// its weight handed over
+	retryQueued = make(chan struct{})
+)
+
+func deferFile(f *deferredFile) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	retryQueue = append(retryQueue, f)
+	close(retryQueued)
+	retryQueued = make(chan struct{})
+}
+
+// holdForRetry hands the in-flight weight of a file over to its deferred
+// document, if it was deferred, so the lines stay counted until written.
+func holdForRetry(inputPath, lang string, weight int64) bool {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	for _, f := range retryQueue {
+		if f.inputPath == inputPath && f.lang == lang && f.weight == 0 {
+			f.weight = weight
+			close(retryQueued)
+			retryQueued = make(chan struct{})
+			return true
+		}
+	}
+	return false
+}
+
+// heldForRetry is the in-flight weight of the deferred files, and a channel
+// closed when that changes.
+func heldForRetry() (int64, <-chan struct{}) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	var weight int64
+	for _, f := range retryQueue {
+		weight += f.weight
+	}
+	return weight, retryQueued
+}
+
+// retryDeferred retries the queued lines once with --retry-workers
+// concurrency and then writes every deferred file, keeping the original
+// text of lines that still fail.
+func retryDeferred() error {
+	retryMu.Lock()
+	queue := retryQueue
+	retryQueue = nil
+	retryMu.Unlock()
+	if len(queue) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, f := range queue {
+		total += len(f.lines)
+	}
+	statusf("\n🔁 Retrying %d line(s) from %d file(s)...\n", total, len(queue))
+
+	select {
+	case <-time.After(retryDelay):
+	case <-runCtx.Done():
+		return aborted()
+	}
+
+	var wg sync.WaitGroup
+	var recovered int64
+	sem := semaphore.NewWeighted(int64(retryWorkers))
+	for _, f := range queue {
+		for _, l := range f.lines {
+			wg.Add(1)
+			if err := sem.Acquire(runCtx, 1); err != nil {
+				wg.Done()
+				break
+			}
+
+			go func(f *deferredFile, l textLine) {
+				defer wg.Done()
+				defer sem.Release(1)
+
+				line := l.b.lines[l.i]
+				translated, cached, err := translateText(line[l.offset:], f.lang)
+				if err != nil {
+					logError(fmt.Sprintf("Retry failed in file '%s' [line %d]: '%s' — %v", f.inputPath, l.b.lineNo+l.i, line, err))
+					return
+				}
+				l.b.lines[l.i] = line[:l.offset] + translated
+				atomic.AddInt64(&failedLineCount, -1)
+				atomic.AddInt64(&lineCounter, 1)
+				atomic.AddInt64(&recovered, 1)
+				f.stats.lineRecovered(l.b, cached)
+			}(f, l)
+		}
+	}
+	wg.Wait()
+	if err := aborted(); err != nil {
+		return err
+	}
+	statusf("🔁 Recovered %d of %d line(s)\n", recovered, total)
+
+	var errs []error
+	for _, f := range queue {
+		if edits := translatedEdits(f.edits, f.stats); len(edits) > 0 {
+			postEditCues(edits, f.lang, f.inputPath)
+		}
+		if err := writeOutput(f.doc, f.inputPath, f.outputPath, f.lang, translatedHashes(f.doc, f.hashes, f.stats)); err != nil {
+			logError(fmt.Sprintf("Translation error %s: %v", f.inputPath, err))
+			errs = append(errs, fmt.Errorf("%s [%s]: %w", f.inputPath, f.lang, err))
+		}
+		if f.weight > 0 {
+			inflightLines.Release(f.weight)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// keyringService is the service name secrets are stored under in the OS
+// keyring.
+const keyringService = "vtt-translator"
+
+// resolveSecret turns a credential reference into its value, so API keys
+// need not be written in flags or config files:
+//
+//	keyring:<name>        OS keyring (Secret Service on Linux, Keychain on macOS,
+//	                      Credential Manager on Windows)
+//	env:<VAR>             environment variable
+//	file:<path>           first line of a file
+//	vault:<path>#<field>  HashiCorp Vault KV secret, via the vault CLI
+//	aws-sm:<secret-id>    AWS Secrets Manager secret string, via the aws CLI
+//
+// Anything else is taken as the credential itself.
+func resolveSecret(ref string) (string, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" {
+		return ref, nil
+	}
+	switch scheme {
+	case "keyring":
+		return keyringSecret(name)
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret %s: environment variable is not set", ref)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", ref, err)
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimSpace(line), nil
+	case "vault":
+		path, field, ok := strings.Cut(name, "#")
+		if !ok || field == "" {
+			return "", fmt.Errorf("secret %s: expected vault:<path>#<field>", ref)
+		}
+		return secretCommand(ref, "vault", "kv", "get", "-field="+field, path)
+	case "aws-sm":
+		return secretCommand(ref, "aws", "secretsmanager", "get-secret-value", "--secret-id", name, "--query", "SecretString", "--output", "text")
+	}
+	// Not a reference, e.g. a key that happens to contain a colon
+	return ref, nil
+}
+
+// secretCommand runs a secret store's CLI and returns what it prints.
+func secretCommand(ref, name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("secret %s needs %s in PATH", ref, name)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return "", fmt.Errorf("secret %s: %s: %w", ref, name, err)
+	}
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty or not found", ref)
+	}
+	return value, nil
+}
+
+// resolveSecrets replaces secret references in the credential flags by
+// their values, once, before any request is made.
+func resolveSecrets() error {
+	for _, secret := range []struct {
+		flag  string
+		value *string
+	}{{"--llm-key", &llmKey}, {"--hf-token", &hfToken}} {
+		value, err := resolveSecret(*secret.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", secret.flag, err)
+		}
+		*secret.value = value
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("  s3cret  \nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VTT_TEST_KEY", "from-env")
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "", want: ""},
+		{ref: "sk-plain", want: "sk-plain"},
+		{ref: "env:VTT_TEST_KEY", want: "from-env"},
+		{ref: "env:VTT_TEST_UNSET_KEY", wantErr: true},
+		{ref: "file:" + keyFile, want: "s3cret"},
+		{ref: "file:" + filepath.Join(dir, "missing"), wantErr: true},
+		{ref: "vault:secret/vtt", wantErr: true},
+		// Not references: unknown scheme, or nothing after the colon
+		{ref: "abc:def", want: "abc:def"},
+		{ref: "env:", want: "env:"},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecret(%q) = %q, %v, want %q, error: %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
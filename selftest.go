@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// selfTestSentences cover plain text, punctuation, markup and a line break,
+// which is what subtitles throw at a provider.
+var selfTestSentences = []string{
+	"Hello, how are you?",
+	"The train leaves at 5 o'clock.",
+	"<i>I never said that.</i>",
+	"Wait!\nDon't go there.",
+	"Tom & Jerry are friends.",
+}
+
+// runSelfTestCommand sends known sentences to the configured provider for
+// every --lang and checks the replies: `selftest [sentence...]`. The cache
+// is bypassed so the provider is really asked.
+func runSelfTestCommand(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sentences := selfTestSentences
+	if fs.NArg() > 0 {
+		sentences = fs.Args()
+	}
+
+	langs := parseLangs(targetLang)
+	if len(langs) == 0 {
+		return errors.New("please specify at least one target language with --lang")
+	}
+	if err := selectProvider(); err != nil {
+		return err
+	}
+	if err := validateLanguages(sourceLang, langs); err != nil {
+		return err
+	}
+	if err := loadPromptSettings(langs); err != nil {
+		return err
+	}
+
+	failed := 0
+	var total time.Duration
+	for _, lang := range langs {
+		fmt.Printf("🧪 %s: %s → %s\n", providerName, sourceLang, lang)
+		for _, text := range sentences {
+			start := time.Now()
+			translated, err := provider.translate(text, sourceLang, lang)
+			elapsed := time.Since(start)
+			total += elapsed
+
+			var problem string
+			if err != nil {
+				problem = err.Error()
+			} else {
+				problem = checkSelfTestReply(text, translated, lang)
+			}
+			if problem != "" {
+				failed++
+				fmt.Printf("  ❌ %q (%v): %s\n", text, elapsed.Round(time.Millisecond), problem)
+				continue
+			}
+			fmt.Printf("  ✅ %q → %q (%v)\n", text, translated, elapsed.Round(time.Millisecond))
+		}
+	}
+
+	count := len(langs) * len(sentences)
+	fmt.Printf("⏱️ Average latency: %v per request\n", (total / time.Duration(count)).Round(time.Millisecond))
+	if failed > 0 {
+		return fmt.Errorf("self-test failed for %d of %d sentences", failed, count)
+	}
+	fmt.Println("✅ Self-test passed")
+	return nil
+}
+
+// checkSelfTestReply describes what is wrong with a translation, or returns
+// "" if it looks usable.
+func checkSelfTestReply(text, translated, lang string) string {
+	if strings.TrimSpace(translated) == "" {
+		return "empty translation"
+	}
+	if translated == text && lang != sourceLang {
+		return "returned unchanged"
+	}
+	for _, tag := range markupTag.FindAllString(text, -1) {
+		if !strings.Contains(translated, tag) {
+			return fmt.Sprintf("markup tag %s lost: %q", tag, translated)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// mergeShortCues joins runs of consecutive cues into one while the joined
+// cue is still short: on screen for less than maxDuration or, with
+// minChars > 0, holding fewer characters. Cues further apart than maxGap
+// are never joined. The text of a joined cue continues the last line of
+// the one before, so the translator sees whole phrases instead of the one-
+// or two-word fragments of auto-generated captions. It returns the number
+// of cues merged away.
+func (s *subtitle) mergeShortCues(maxDuration time.Duration, minChars int, maxGap time.Duration) int {
+	short := func(cue *block) bool {
+		if cue.times.end-cue.times.start < maxDuration {
+			return true
+		}
+		chars := 0
+		for _, line := range cue.lines {
+			chars += utf8.RuneCountInString(plainText(line))
+		}
+		return chars < minChars
+	}
+
+	numbered := true
+	for i, cue := range s.cues() {
+		numbered = numbered && cue.id == strconv.Itoa(i+1)
+	}
+
+	merged := 0
+	var prev *block
+	blocks := s.blocks[:0]
+	for _, b := range s.blocks {
+		if b.kind != blockCue || b.isJSONPayload() {
+			prev = nil
+			blocks = append(blocks, b)
+			continue
+		}
+		if prev != nil && len(prev.lines) > 0 && short(prev) && b.times.start-prev.times.end <= maxGap && len(b.lines) > 0 {
+			last := len(prev.lines) - 1
+			prev.lines[last] = strings.TrimRight(prev.lines[last], " ") + " " + strings.TrimLeft(b.lines[0], " ")
+			prev.lines = append(prev.lines, b.lines[1:]...)
+			prev.setTimes(prev.times.start, max(prev.times.end, b.times.end))
+			if s.captions != nil {
+				s.captions.remove(b)
+			}
+			merged++
+			continue
+		}
+		prev = b
+		blocks = append(blocks, b)
+	}
+	s.blocks = blocks
+
+	// Keep SRT counters consecutive
+	if numbered && merged > 0 {
+		for i, cue := range s.cues() {
+			cue.id = strconv.Itoa(i + 1)
+		}
+	}
+	return merged
+}
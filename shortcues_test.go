@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeShortCues(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		maxDuration time.Duration
+		minChars    int
+		merged      int
+		want        string
+	}{
+		{
+			name:        "fragments of auto-generated captions",
+			text:        "WEBVTT\n\n00:00.000 --> 00:00.400\nso what\n\n00:00.400 --> 00:00.900\nwe did\n\n00:00.900 --> 00:01.500\nwas this\n\n00:05.000 --> 00:06.000\nLater\n",
+			maxDuration: time.Second,
+			merged:      2,
+			want:        "WEBVTT\n\n00:00.000 --> 00:01.500\nso what we did was this\n\n00:05.000 --> 00:06.000\nLater\n",
+		},
+		{
+			name:        "SRT counters stay consecutive",
+			text:        "1\n00:00:00,000 --> 00:00:00,500\nOne\n\n2\n00:00:00,600 --> 00:00:02,000\ntwo\n\n3\n00:00:03,000 --> 00:00:05,000\nThree\n",
+			maxDuration: time.Second,
+			merged:      1,
+			want:        "1\n00:00:00,000 --> 00:00:02,000\nOne two\n\n2\n00:00:03,000 --> 00:00:05,000\nThree\n",
+		},
+		{
+			name:        "gap too large",
+			text:        "WEBVTT\n\n00:00.000 --> 00:00.500\nOne\n\n00:01.500 --> 00:02.000\nTwo\n",
+			maxDuration: time.Second,
+			merged:      0,
+			want:        "WEBVTT\n\n00:00.000 --> 00:00.500\nOne\n\n00:01.500 --> 00:02.000\nTwo\n",
+		},
+		{
+			name:        "few characters",
+			text:        "WEBVTT\n\n00:00.000 --> 00:03.000\n<i>Hi</i>\n\n00:03.100 --> 00:06.000\nthere, friend\n\n00:06.100 --> 00:09.000\nHow are you?\n",
+			maxDuration: time.Second,
+			minChars:    10,
+			merged:      1,
+			want:        "WEBVTT\n\n00:00.000 --> 00:06.000\n<i>Hi</i> there, friend\n\n00:06.100 --> 00:09.000\nHow are you?\n",
+		},
+		{
+			name:        "multi-line cues continue the last line",
+			text:        "WEBVTT\n\n00:00.000 --> 00:00.500\n- Who\n- Me\n\n00:00.500 --> 00:02.000\nand you\nand them\n",
+			maxDuration: time.Second,
+			merged:      1,
+			want:        "WEBVTT\n\n00:00.000 --> 00:02.000\n- Who\n- Me and you\nand them\n",
+		},
+		{
+			name:        "notes break runs",
+			text:        "WEBVTT\n\n00:00.000 --> 00:00.500\nOne\n\nNOTE keep apart\n\n00:00.500 --> 00:01.000\nTwo\n",
+			maxDuration: time.Second,
+			merged:      0,
+			want:        "WEBVTT\n\n00:00.000 --> 00:00.500\nOne\n\nNOTE keep apart\n\n00:00.500 --> 00:01.000\nTwo\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, newline := splitLines(tt.text)
+			doc := parseSubtitle(lines, newline)
+			if merged := doc.mergeShortCues(tt.maxDuration, tt.minChars, 500*time.Millisecond); merged != tt.merged {
+				t.Errorf("merged %d cues, want %d", merged, tt.merged)
+			}
+			if got := doc.render(); got != tt.want {
+				t.Errorf("render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONCaptionsMerge(t *testing.T) {
+	doc, err := parseJSONCaptions([]byte(`[{"start":0,"end":500,"text":"Hello"},{"start":600,"end":1000,"text":"world"},{"start":5000,"end":8000,"text":"Bye"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := doc.mergeShortCues(time.Second, 0, 500*time.Millisecond); n != 1 {
+		t.Fatalf("merged %d cues, want 1", n)
+	}
+	want := `[{"end":1000,"start":0,"text":"Hello world"},{"end":8000,"start":5000,"text":"Bye"}]` + "\n"
+	if got := doc.render(); got != want {
+		t.Errorf("render() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// spellDictionaries maps target language codes to the usual hunspell
+// dictionary names; other codes are passed to hunspell unchanged.
+var spellDictionaries = map[string]string{
+	"ru": "ru_RU",
+	"de": "de_DE",
+	"fr": "fr_FR",
+	"es": "es_ES",
+	"it": "it_IT",
+	"pt": "pt_PT",
+	"pl": "pl_PL",
+	"uk": "uk_UA",
+	"nl": "nl_NL",
+	"en": "en_US",
+}
+
+func spellDictionary(lang string) string {
+	if spellDict != "" {
+		return spellDict
+	}
+	if dict, ok := spellDictionaries[lang]; ok {
+		return dict
+	}
+	return lang
+}
+
+// checkSpelling runs the translated cues of doc through hunspell and adds
+// every cue with unknown words to the quality report.
+func checkSpelling(doc *subtitle, outputPath, lang string) error {
+	var cues []*block
+	var lines []string
+	for _, cue := range doc.cues() {
+		for _, line := range cue.lines {
+			cues = append(cues, cue)
+			lines = append(lines, plainText(line))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	misspelled, err := misspelledWords(spellDictionary(lang), lines)
+	if err != nil {
+		return err
+	}
+	for i, words := range misspelled {
+		if len(words) > 0 {
+			reportIssue(outputPath, cues[i], "spelling", fmt.Sprintf("unknown %s in %q", strings.Join(words, ", "), lines[i]))
+		}
+	}
+	return nil
+}
+
+// misspelledWords talks to `hunspell -a` (the ispell pipe protocol): every
+// input line yields one result line per word followed by an empty line.
+// "&" and "#" results are unknown words.
+func misspelledWords(dict string, lines []string) ([][]string, error) {
+	var input bytes.Buffer
+	for _, line := range lines {
+		// "^" keeps lines starting with ispell command characters literal
+		input.WriteString("^" + strings.ReplaceAll(line, "\n", " ") + "\n")
+	}
+
+	cmd := exec.CommandContext(runCtx, "hunspell", "-a", "-i", "utf-8", "-d", dict)
+	cmd.Stdin = &input
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("hunspell -d %s: %v: %s", dict, err, strings.TrimSpace(stderr.String()))
+	}
+
+	result := make([][]string, len(lines))
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	// The first line is the version banner
+	scanner.Scan()
+	i := 0
+	for scanner.Scan() && i < len(lines) {
+		line := scanner.Text()
+		if line == "" {
+			i++
+			continue
+		}
+		if line[0] == '&' || line[0] == '#' {
+			if fields := strings.Fields(line); len(fields) > 1 {
+				result[i] = append(result[i], fields[1])
+			}
+		}
+	}
+	return result, scanner.Err()
+}
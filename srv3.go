@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatSRV3 is YouTube's XML caption format, <timedtext format="3">.
+const formatSRV3 = "srv3"
+
+// srv3Captions keeps the source of an srv3 file, so rendering rewrites only
+// the <p> elements of changed cues and copies everything else byte for byte.
+type srv3Captions struct {
+	data    []byte
+	paras   []*srv3Para // in document order
+	objects map[*block]*srv3Para
+}
+
+// srv3Para is one <p t="ms" d="ms"> element and what its cue was parsed from.
+type srv3Para struct {
+	start, end      int // byte span of the whole element
+	inner, innerEnd int // byte span of its content
+	attrs           []xml.Attr
+	lines           []string
+	times           cueTiming
+	removed         bool
+}
+
+// parseSRV3 reads <timedtext format="3"><body><p t="0" d="1500">text</p>
+// ...</body></timedtext>. Text of <s> word segments is joined and <br/>
+// starts a new line.
+func parseSRV3(data []byte) (*subtitle, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Entity = xml.HTMLEntity
+	captions := &srv3Captions{data: data, objects: map[*block]*srv3Para{}}
+	doc := &subtitle{newline: "\n", captions: captions}
+
+	var para *srv3Para
+	var text strings.Builder
+	depth, seenRoot := 0, false
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.RawToken()
+		if err == io.EOF && seenRoot && depth == 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errNotCaptions, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1 && t.Name.Local != "timedtext":
+				return nil, errNotCaptions
+			case depth == 1:
+				seenRoot = true
+			case para == nil && t.Name.Local == "p":
+				para = &srv3Para{start: offset, inner: int(dec.InputOffset()), attrs: t.Attr}
+				text.Reset()
+			case para != nil && t.Name.Local == "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			depth--
+			if para != nil && t.Name.Local == "p" {
+				para.innerEnd, para.end = offset, int(dec.InputOffset())
+				captions.paras = append(captions.paras, para)
+				// Empty paragraphs only position the window or break lines
+				if content := strings.TrimSpace(text.String()); content != "" {
+					start := srv3Millis(para.attrs, "t")
+					para.times = cueTiming{start: start, end: start + srv3Millis(para.attrs, "d")}
+					para.lines = strings.Split(content, "\n")
+					cue := &block{kind: blockCue, timing: para.times.String(), times: para.times, lines: slices.Clone(para.lines), lineNo: len(captions.paras)}
+					doc.blocks = append(doc.blocks, cue)
+					captions.objects[cue] = para
+				}
+				para = nil
+			}
+		case xml.CharData:
+			if para != nil {
+				text.Write(t)
+			}
+		}
+	}
+	return doc, nil
+}
+
+func srv3Millis(attrs []xml.Attr, name string) time.Duration {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			ms, _ := strconv.ParseInt(a.Value, 10, 64)
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// remove drops the <p> of a cue that was merged into another one.
+func (c *srv3Captions) remove(cue *block) {
+	if p, ok := c.objects[cue]; ok {
+		p.removed = true
+		delete(c.objects, cue)
+	}
+}
+
+var srv3Escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// render copies the source, rewriting the timing attributes of retimed
+// cues and the content of translated ones. A translated <p> holds plain
+// text: per-word <s> segments no longer apply to the translation.
+func (c *srv3Captions) render() string {
+	cues := make(map[*srv3Para]*block, len(c.objects))
+	for cue, p := range c.objects {
+		cues[p] = cue
+	}
+	var sb strings.Builder
+	last := 0
+	for _, p := range c.paras {
+		cue := cues[p]
+		if !p.removed && (cue == nil || cue.times == p.times && slices.Equal(cue.lines, p.lines)) {
+			continue
+		}
+		sb.Write(c.data[last:p.start])
+		last = p.end
+		if p.removed {
+			continue
+		}
+		sb.WriteString("<p")
+		for _, a := range p.attrs {
+			value := a.Value
+			switch a.Name.Local {
+			case "t":
+				value = strconv.FormatInt(cue.times.start.Round(time.Millisecond).Milliseconds(), 10)
+			case "d":
+				value = strconv.FormatInt((cue.times.end - cue.times.start).Round(time.Millisecond).Milliseconds(), 10)
+			}
+			name := a.Name.Local
+			if a.Name.Space != "" {
+				name = a.Name.Space + ":" + name
+			}
+			fmt.Fprintf(&sb, " %s=\"%s\"", name, strings.ReplaceAll(srv3Escaper.Replace(value), `"`, "&quot;"))
+		}
+		sb.WriteString(">")
+		if slices.Equal(cue.lines, p.lines) {
+			sb.Write(c.data[p.inner:p.innerEnd])
+		} else {
+			sb.WriteString(srv3Escaper.Replace(strings.Join(cue.lines, "\n")))
+		}
+		sb.WriteString("</p>")
+	}
+	sb.Write(c.data[last:])
+	return sb.String()
+}
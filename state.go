@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// runState remembers, per output file, the payload hashes of the source cues
+// it was produced from. On the next run only cues whose hash changed are
+// re-translated; the rest are copied from the existing output.
+type runState struct {
+	mu    sync.Mutex
+	Files map[string][]string `json:"files"`
+}
+
+var cueState = &runState{Files: map[string][]string{}}
+
+func loadState(path string) error {
+	files, err := readStateFile(path)
+	if err != nil {
+		return err
+	}
+	cueState.Files = files
+	return nil
+}
+
+func saveState(path string) error {
+	cueState.mu.Lock()
+	defer cueState.mu.Unlock()
+	return writeStateFile(path, cueState.Files)
+}
+
+// readStateFile reads the hashes per output file; a missing file has none.
+func readStateFile(path string) (map[string][]string, error) {
+	state := runState{Files: map[string][]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state.Files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = map[string][]string{}
+	}
+	return state.Files, nil
+}
+
+func writeStateFile(path string, files map[string][]string) error {
+	data, err := json.MarshalIndent(&runState{Files: files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+func stateKey(outputPath string) string {
+	if abs, err := filepath.Abs(outputPath); err == nil {
+		return abs
+	}
+	return outputPath
+}
+
+func (s *runState) hashes(outputPath string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Files[stateKey(outputPath)]
+}
+
+func (s *runState) record(outputPath string, hashes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files[stateKey(outputPath)] = hashes
+}
+
+// translatedHashes blanks the hashes of cues with lines that failed and
+// kept their source text, so the next run translates them again instead of
+// reusing them as done.
+func translatedHashes(doc *subtitle, hashes []string, stats *fileStats) []string {
+	recorded := slices.Clone(hashes)
+	for i, cue := range doc.cues() {
+		if i < len(recorded) && stats.hasFailedLines(cue) {
+			recorded[i] = ""
+		}
+	}
+	return recorded
+}
+
+// patchFromPreviousOutput copies translations of unchanged cues from the
+// existing output into doc and returns the cues that need no translation.
+// hashes are the source payload hashes of doc, computed before translation.
+func patchFromPreviousOutput(doc *subtitle, hashes []string, outputPath string) map[*block]bool {
+	previous := cueState.hashes(outputPath)
+	if len(previous) == 0 {
+		return nil
+	}
+
+	out, _, err := readSubtitle(outputPath, 0)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logError(fmt.Sprintf("Failed to read previous output %s: %v", outputPath, err))
+		}
+		return nil
+	}
+	outCues := out.cues()
+	if len(outCues) != len(previous) {
+		logError(fmt.Sprintf("Previous output %s has %d cues, expected %d — translating it from scratch", outputPath, len(outCues), len(previous)))
+		return nil
+	}
+
+	byHash := make(map[string]*block, len(previous))
+	for i, h := range previous {
+		if _, ok := byHash[h]; !ok && h != "" {
+			byHash[h] = outCues[i]
+		}
+	}
+
+	reused := map[*block]bool{}
+	for i, cue := range doc.cues() {
+		if old, ok := byHash[hashes[i]]; ok {
+			cue.lines = append([]string(nil), old.lines...)
+			reused[cue] = true
+		}
+	}
+	return reused
+}
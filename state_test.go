@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func parseTestSubtitle(text string) *subtitle {
+	lines, newline := splitLines(text)
+	return parseSubtitle(lines, newline)
+}
+
+func cueHashes(doc *subtitle) []string {
+	var hashes []string
+	for _, cue := range doc.cues() {
+		hashes = append(hashes, cue.hash())
+	}
+	return hashes
+}
+
+func TestPatchFromPreviousOutput(t *testing.T) {
+	defer func(files map[string][]string) { cueState.Files = files }(cueState.Files)
+
+	const source = "WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n\n00:03.000 --> 00:04.000\nBye\n\n00:05.000 --> 00:06.000\nHello\n"
+	const output = "WEBVTT\n\n00:01.000 --> 00:02.000\nПривет\n\n00:03.000 --> 00:04.000\nПока\n\n00:05.000 --> 00:06.000\nПривет\n"
+	previous := cueHashes(parseTestSubtitle(source))
+
+	tests := []struct {
+		name     string
+		source   string
+		output   string
+		recorded []string
+		want     []string
+		reused   int
+	}{
+		{
+			name:     "unchanged file",
+			source:   source,
+			output:   output,
+			recorded: previous,
+			want:     []string{"Привет", "Пока", "Привет"},
+			reused:   3,
+		},
+		{
+			name:     "edited, inserted and retimed cues",
+			source:   "WEBVTT\n\n00:00.500 --> 00:01.000\nNew\n\n00:01.500 --> 00:02.500\nHello\n\n00:03.000 --> 00:04.000\nBye now\n",
+			output:   output,
+			recorded: previous,
+			want:     []string{"New", "Привет", "Bye now"},
+			reused:   1,
+		},
+		{
+			// A cue whose lines failed kept its source text in the output
+			name:     "cue that failed last time",
+			source:   source,
+			output:   "WEBVTT\n\n00:01.000 --> 00:02.000\nПривет\n\n00:03.000 --> 00:04.000\nBye\n\n00:05.000 --> 00:06.000\nПривет\n",
+			recorded: []string{previous[0], "", previous[2]},
+			want:     []string{"Привет", "Bye", "Привет"},
+			reused:   2,
+		},
+		{
+			name:     "output edited by hand",
+			source:   source,
+			output:   "WEBVTT\n\n00:01.000 --> 00:02.000\nПривет\n",
+			recorded: previous,
+			want:     []string{"Hello", "Bye", "Hello"},
+			reused:   0,
+		},
+		{
+			name:   "no previous run",
+			source: source,
+			output: output,
+			want:   []string{"Hello", "Bye", "Hello"},
+			reused: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "ep.ru.vtt")
+			if err := os.WriteFile(outputPath, []byte(tt.output), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cueState.Files = map[string][]string{}
+			if tt.recorded != nil {
+				cueState.record(outputPath, tt.recorded)
+			}
+
+			doc := parseTestSubtitle(tt.source)
+			reused := patchFromPreviousOutput(doc, cueHashes(doc), outputPath)
+			if len(reused) != tt.reused {
+				t.Errorf("reused %d cues, want %d", len(reused), tt.reused)
+			}
+			var got []string
+			for _, cue := range doc.cues() {
+				got = append(got, cue.lines...)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("cues = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslatedHashes(t *testing.T) {
+	doc := parseTestSubtitle("WEBVTT\n\n00:01.000 --> 00:02.000\nOne\n\n00:03.000 --> 00:04.000\nTwo\n\n00:05.000 --> 00:06.000\nThree\n")
+	hashes := cueHashes(doc)
+	cues := doc.cues()
+	stats := &fileStats{}
+	stats.lineFailed(cues[1])
+	stats.lineFailed(cues[2])
+	stats.lineRecovered(cues[2], false)
+
+	recorded := translatedHashes(doc, hashes, stats)
+	if want := []string{hashes[0], "", hashes[2]}; !slices.Equal(recorded, want) {
+		t.Errorf("translatedHashes() = %q, want %q", recorded, want)
+	}
+	if hashes[1] == "" {
+		t.Error("translatedHashes() changed its argument")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stopwords are frequent short words used to guess the language of a
+// subtitle; a guess needs at least minStopwordHits of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "you", "is", "to", "of", "it", "that", "what", "this", "i'm", "don't"},
+	"ru": {"и", "в", "не", "что", "я", "ты", "на", "это", "он", "как", "вы", "мы"},
+	"uk": {"і", "що", "це", "не", "ти", "та", "як", "він", "ми", "ви", "мене", "якщо"},
+	"de": {"und", "der", "die", "das", "ich", "nicht", "ist", "du", "sie", "es", "ein", "was"},
+	"fr": {"le", "la", "les", "et", "je", "est", "vous", "pas", "que", "une", "c'est", "tu"},
+	"es": {"el", "la", "que", "de", "y", "no", "es", "los", "por", "qué", "una", "está"},
+	"it": {"il", "che", "non", "di", "è", "la", "un", "per", "sono", "mi", "cosa", "ho"},
+	"pt": {"o", "que", "não", "de", "é", "um", "uma", "você", "eu", "com", "isso", "está"},
+}
+
+const minStopwordHits = 5
+
+// subtitleStats are the figures `stats` reports for one file.
+type subtitleStats struct {
+	path     string
+	cues     int
+	duration time.Duration
+	chars    int
+	words    int
+	lang     string
+
+	// Translation workload for one target language
+	lines     int
+	lineChars int
+	texts     []string
+}
+
+// runStatsCommand summarizes the subtitles under a file or directory
+// without translating anything: `stats [path]` (default: --input).
+func runStatsCommand(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	root := inputPath
+	if fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+	if root == "" || fs.NArg() > 1 {
+		return errors.New("usage: stats <file or directory>")
+	}
+	// Skip outputs of --lang like a translation run would
+	targetLangs = parseLangs(targetLang)
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	if info.IsDir() {
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && isOutputDir(path) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") && isSubtitleFile(info.Name()) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		paths = []string{root}
+	}
+
+	var all []*subtitleStats
+	for _, path := range paths {
+		st, err := fileSubtitleStats(path)
+		if errors.Is(err, errNotCaptions) && path != root {
+			continue
+		}
+		if err != nil {
+			statusf("⚠️ %s: %v\n", path, err)
+			continue
+		}
+		all = append(all, st)
+	}
+	printSubtitleStats(all)
+	return nil
+}
+
+func fileSubtitleStats(path string) (*subtitleStats, error) {
+	doc, _, err := readSubtitle(path, inputFPS)
+	if err != nil {
+		return nil, err
+	}
+	st := &subtitleStats{path: path}
+	var text strings.Builder
+	chapters := chapterMode == "on" || chapterMode == "auto" && doc.isChapterTrack(path)
+	for _, b := range doc.blocks {
+		if b.kind == blockCue {
+			st.cues++
+			st.duration += b.times.end - b.times.start
+			for _, line := range b.lines {
+				plain := plainText(line)
+				st.chars += utf8.RuneCountInString(plain)
+				st.words += len(strings.Fields(plain))
+				text.WriteString(plain + "\n")
+			}
+		}
+		if chapters && b.kind == blockCue && b.isJSONPayload() || b.kind == blockNote && !translateNotes {
+			continue
+		}
+		for i := range b.lines {
+			if offset, ok := b.translatableText(i); ok {
+				line := strings.TrimSpace(b.lines[i][offset:])
+				st.lines++
+				st.lineChars += utf8.RuneCountInString(line)
+				st.texts = append(st.texts, line)
+			}
+		}
+	}
+	st.lang = detectLanguage(text.String())
+	return st, nil
+}
+
+// detectLanguage guesses the language by counting stopwords, falling back
+// to the dominant script when no guess is confident.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		counts[word]++
+	}
+	best, bestHits := "", 0
+	for lang, words := range stopwords {
+		hits := 0
+		for _, w := range words {
+			hits += counts[w]
+		}
+		if hits > bestHits || hits == bestHits && lang < best {
+			best, bestHits = lang, hits
+		}
+	}
+	if bestHits >= minStopwordHits {
+		return best
+	}
+
+	scripts := map[string]int{}
+	for _, r := range text {
+		for _, name := range []string{"Latin", "Cyrillic", "Han", "Arabic", "Hangul", "Hiragana", "Katakana", "Greek", "Hebrew", "Devanagari", "Thai"} {
+			if unicode.Is(unicode.Scripts[name], r) {
+				scripts[name]++
+				break
+			}
+		}
+	}
+	script, most := "", 0
+	for name, n := range scripts {
+		if n > most || n == most && name < script {
+			script, most = name, n
+		}
+	}
+	if script == "" {
+		return "?"
+	}
+	return "? (" + script + ")"
+}
+
+// printSubtitleStats prints a table of the files, the totals and the
+// estimated workload of translating them into every --lang.
+func printSubtitleStats(all []*subtitleStats) {
+	sort.Slice(all, func(i, j int) bool { return all[i].path < all[j].path })
+
+	var total subtitleStats
+	languages := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "cues\tduration\tcharacters\twords\tlanguage\t \tfile")
+	for _, st := range all {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t \t%s\n", st.cues, formatDuration(st.duration), st.chars, st.words, st.lang, st.path)
+		total.cues += st.cues
+		total.duration += st.duration
+		total.chars += st.chars
+		total.words += st.words
+		total.lines += st.lines
+		total.lineChars += st.lineChars
+		languages[st.lang]++
+	}
+	_ = w.Flush()
+
+	var langs []string
+	for lang, n := range languages {
+		langs = append(langs, fmt.Sprintf("%s (%d)", lang, n))
+	}
+	sort.Strings(langs)
+	fmt.Printf("\n📚 %d files, %d cues, %s of subtitles, %d characters, %d words\n",
+		len(all), total.cues, formatDuration(total.duration), total.chars, total.words)
+	if len(langs) > 0 {
+		fmt.Printf("🌐 Languages: %s\n", strings.Join(langs, ", "))
+	}
+
+	if len(targetLangs) == 0 || total.lines == 0 {
+		return
+	}
+	var cache cacheEntries
+	if cachePath != "" {
+		cache, _ = readCacheFile(cachePath)
+	}
+	for _, lang := range targetLangs {
+		cached := cache[pairKey(cacheEngine(), sourceLang, lang)]
+		lines, chars := 0, 0
+		for _, st := range all {
+			for _, text := range st.texts {
+				if _, ok := cached[text]; !ok {
+					lines++
+					chars += utf8.RuneCountInString(text)
+				}
+			}
+		}
+		fmt.Printf("🧮 Workload %s → %s: %d of %d lines to translate, %d characters (%d already cached)\n",
+			sourceLang, lang, lines, total.lines, chars, total.lines-lines)
+	}
+}
+
+// formatDuration prints h:mm:ss, which reads better than 1h2m3.5s in a table.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// styleRules are the limits of a subtitle style guide; a zero value
+// disables its rule.
+type styleRules struct {
+	MaxLineLength int     `json:"max_line_length"`
+	MaxLines      int     `json:"max_lines"`
+	MaxCPS        float64 `json:"max_cps"`
+	MinDurationMs int     `json:"min_duration_ms"`
+	MaxDurationMs int     `json:"max_duration_ms"`
+	MinGapMs      int     `json:"min_gap_ms"`
+}
+
+// styleGuidePresets follow the Netflix Timed Text Style Guide: 42
+// characters per line, two lines, 5/6 s to 7 s on screen, two frames at
+// 24 fps between cues, and 20 characters per second (17 for children's
+// programs).
+var styleGuidePresets = map[string]styleRules{
+	"netflix":      {MaxLineLength: 42, MaxLines: 2, MaxCPS: 20, MinDurationMs: 833, MaxDurationMs: 7000, MinGapMs: 83},
+	"netflix-kids": {MaxLineLength: 42, MaxLines: 2, MaxCPS: 17, MinDurationMs: 833, MaxDurationMs: 7000, MinGapMs: 83},
+}
+
+var (
+	styleGuideRules *styleRules
+
+	styleCueCounter    int64
+	styleFailedCounter int64
+)
+
+// loadStyleGuide resolves --style-guide: a preset name or a JSON rules
+// file, which may start from a preset and override some of its limits:
+// {"preset": "netflix", "max_cps": 17}.
+func loadStyleGuide(spec string) (*styleRules, error) {
+	if rules, ok := styleGuidePresets[spec]; ok {
+		return &rules, nil
+	}
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		var names []string
+		for name := range styleGuidePresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("--style-guide %q is neither a preset (%s) nor a readable rules file: %w", spec, strings.Join(names, ", "), err)
+	}
+
+	var base struct {
+		Preset string `json:"preset"`
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", spec, err)
+	}
+	var rules styleRules
+	if base.Preset != "" {
+		preset, ok := styleGuidePresets[base.Preset]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown preset %q", spec, base.Preset)
+		}
+		rules = preset
+	}
+	// Fields present in the file override the preset
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", spec, err)
+	}
+	return &rules, nil
+}
+
+// checkStyle adds every cue of a translated document that breaks the style
+// guide to the quality report.
+func checkStyle(doc *subtitle, outputPath string) {
+	r := styleGuideRules
+	var prev *block
+	for _, cue := range doc.cues() {
+		if cue.isJSONPayload() {
+			continue
+		}
+		failed := false
+		report := func(check, format string, args ...any) {
+			reportIssue(outputPath, cue, check, fmt.Sprintf(format, args...))
+			failed = true
+		}
+
+		chars := 0
+		for _, line := range cue.lines {
+			n := utf8.RuneCountInString(plainText(line))
+			chars += n
+			if r.MaxLineLength > 0 && n > r.MaxLineLength {
+				report("line length", "%d characters in %q, max %d", n, line, r.MaxLineLength)
+			}
+		}
+		if r.MaxLines > 0 && len(cue.lines) > r.MaxLines {
+			report("line count", "%d lines, max %d", len(cue.lines), r.MaxLines)
+		}
+
+		duration := cue.times.end - cue.times.start
+		if r.MaxCPS > 0 && duration > 0 {
+			if cps := float64(chars) / duration.Seconds(); cps > r.MaxCPS {
+				report("reading speed", "%.1f characters/s, max %g", cps, r.MaxCPS)
+			}
+		}
+		if limit := time.Duration(r.MinDurationMs) * time.Millisecond; limit > 0 && duration < limit {
+			report("duration", "%v on screen, min %v", duration, limit)
+		}
+		if limit := time.Duration(r.MaxDurationMs) * time.Millisecond; limit > 0 && duration > limit {
+			report("duration", "%v on screen, max %v", duration, limit)
+		}
+		if limit := time.Duration(r.MinGapMs) * time.Millisecond; limit > 0 && prev != nil {
+			gap := cue.times.start - prev.times.end
+			if gap < 0 {
+				report("gap", "overlaps the previous cue by %v", -gap)
+			} else if gap < limit {
+				report("gap", "%v after the previous cue, min %v", gap, limit)
+			}
+		}
+		prev = cue
+
+		atomic.AddInt64(&styleCueCounter, 1)
+		if failed {
+			atomic.AddInt64(&styleFailedCounter, 1)
+		}
+	}
+}
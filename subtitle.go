@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// blockKind classifies a blank-line separated block of a subtitle file.
+type blockKind int
+
+const (
+	blockOther blockKind = iota
+	blockHeader
+	blockCue
+	blockNote
+	blockStyle
+	blockRegion
+)
+
+// block is one blank-line separated chunk of a subtitle file. For cues the
+// identifier and timing line are kept apart from the payload, so only the
+// payload ever reaches the translator.
+type block struct {
+	kind   blockKind
+	id     string
+	timing string // raw timing line, re-rendered only when times change
+	times  cueTiming
+	lines  []string
+	lineNo int // 1-based line number of lines[0] in the source file
+}
+
+type subtitle struct {
+	blocks  []*block
+	newline string
+	fps     float64 // frame rate of frame-timed sources, 0 otherwise
+
+	captions captionDocument // document of JSON and XML caption sources, nil otherwise
+}
+
+// readLines returns the lines of a text file without line terminators and
+// the newline sequence the file uses, so output can keep CRLF files CRLF.
+func readLines(path string) ([]string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lines, newline := splitLines(string(data))
+	return lines, newline, nil
+}
+
+// splitLines splits text into lines and reports its line ending.
+func splitLines(text string) ([]string, string) {
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil, newline
+	}
+	return strings.Split(text, "\n"), newline
+}
+
+func parseSubtitle(lines []string, newline string) *subtitle {
+	doc := &subtitle{newline: newline}
+	var chunk []string
+	chunkStart := 0
+
+	flush := func() {
+		if len(chunk) > 0 {
+			doc.blocks = append(doc.blocks, newBlock(chunk, chunkStart, len(doc.blocks) == 0))
+		}
+		chunk = nil
+	}
+
+	for i, line := range lines {
+		if i == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if chunk == nil {
+			chunkStart = i + 1
+		}
+		chunk = append(chunk, line)
+	}
+	flush()
+	return doc
+}
+
+func newBlock(lines []string, lineNo int, first bool) *block {
+	if first && strings.HasPrefix(lines[0], "WEBVTT") {
+		return &block{kind: blockHeader, lines: lines, lineNo: lineNo}
+	}
+	if isNoteStart(lines[0]) {
+		return &block{kind: blockNote, lines: lines, lineNo: lineNo}
+	}
+	// CSS and region definitions are never text and must survive byte-for-byte
+	switch strings.TrimRight(lines[0], " \t") {
+	case "STYLE":
+		return &block{kind: blockStyle, lines: lines, lineNo: lineNo}
+	case "REGION":
+		return &block{kind: blockRegion, lines: lines, lineNo: lineNo}
+	}
+	// A cue starts with its timing line, optionally preceded by an identifier
+	// (WebVTT cue ID or SRT counter). The identifier is never translated.
+	if t, ok := parseTiming(lines[0]); ok {
+		return &block{kind: blockCue, timing: lines[0], times: t, lines: lines[1:], lineNo: lineNo + 1}
+	}
+	if len(lines) > 1 && !strings.Contains(lines[0], "-->") {
+		if t, ok := parseTiming(lines[1]); ok {
+			return &block{kind: blockCue, id: lines[0], timing: lines[1], times: t, lines: lines[2:], lineNo: lineNo + 2}
+		}
+	}
+	return &block{kind: blockOther, lines: lines, lineNo: lineNo}
+}
+
+// setTimes moves a cue, keeping its settings and timestamp style.
+func (b *block) setTimes(start, end time.Duration) {
+	b.times.start, b.times.end = start, end
+	b.timing = b.times.String()
+}
+
+func (s *subtitle) cues() []*block {
+	var cues []*block
+	for _, b := range s.blocks {
+		if b.kind == blockCue {
+			cues = append(cues, b)
+		}
+	}
+	return cues
+}
+
+func (s *subtitle) render() string {
+	if s.captions != nil {
+		return s.captions.render()
+	}
+	nl := s.newline
+	if nl == "" {
+		nl = "\n"
+	}
+
+	var sb strings.Builder
+	for i, b := range s.blocks {
+		if i > 0 {
+			sb.WriteString(nl)
+		}
+		if b.kind == blockCue {
+			if b.id != "" {
+				sb.WriteString(b.id + nl)
+			}
+			sb.WriteString(b.timing + nl)
+		}
+		for _, line := range b.lines {
+			sb.WriteString(line + nl)
+		}
+	}
+	return sb.String()
+}
+
+// isChapterTrack reports whether the file is a WebVTT chapter track: either
+// its header declares "Kind: chapters" or its name mentions chapters, as
+// HLS packagers usually do (e.g. chapters_en.vtt).
+func (s *subtitle) isChapterTrack(path string) bool {
+	for _, b := range s.blocks {
+		if b.kind != blockHeader {
+			continue
+		}
+		for _, line := range b.lines[1:] {
+			if key, _, value, ok := headerField(line); ok && strings.EqualFold(key, "kind") {
+				return strings.EqualFold(strings.TrimSpace(value), "chapters")
+			}
+		}
+	}
+	return strings.Contains(strings.ToLower(filepath.Base(path)), "chapter")
+}
+
+// isJSONPayload reports whether a cue carries a JSON payload (chapter
+// metadata) rather than text meant for people.
+func (b *block) isJSONPayload() bool {
+	payload := strings.TrimSpace(strings.Join(b.lines, "\n"))
+	if !strings.HasPrefix(payload, "{") && !strings.HasPrefix(payload, "[") {
+		return false
+	}
+	return json.Valid([]byte(payload))
+}
+
+// hash identifies a cue by its payload only, so retimed cues still match.
+func (b *block) hash() string {
+	sum := sha256.Sum256([]byte(strings.Join(b.lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// translatableText reports whether line i of the block is sent to the
+// translator and from which byte offset; the part before it is kept as is.
+func (b *block) translatableText(i int) (offset int, ok bool) {
+	text := b.lines[i]
+	switch b.kind {
+	case blockCue:
+		return 0, strings.TrimSpace(text) != ""
+	case blockHeader, blockStyle, blockRegion:
+		return 0, false
+	case blockNote:
+		if i == 0 {
+			// "NOTE this is a comment": only the comment is text
+			offset = len(text) - len(strings.TrimLeft(text[len("NOTE"):], " \t"))
+		}
+		return offset, strings.TrimSpace(text[offset:]) != ""
+	}
+	return 0, strings.TrimSpace(text) != "" && text != "WEBVTT" && !strings.Contains(text, "-->")
+}
+
+// isNoteStart reports whether a line opens a WebVTT NOTE comment block.
+func isNoteStart(line string) bool {
+	return line == "NOTE" || strings.HasPrefix(line, "NOTE ") || strings.HasPrefix(line, "NOTE\t")
+}
+
+// headerField splits a WEBVTT header line such as "Language: en" or
+// "X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:0" into its key and the
+// separator-inclusive prefix. ok is false for lines without a key.
+func headerField(line string) (key, prefix, value string, ok bool) {
+	i := strings.IndexAny(line, ":=")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	key = strings.TrimSpace(line[:i])
+	rest := line[i+1:]
+	value = strings.TrimLeft(rest, " \t")
+	return key, line[:len(line)-len(value)], value, true
+}
+
+// isHeaderMetadata reports whether a header key is machine-readable metadata
+// that must never be sent to the translator.
+func isHeaderMetadata(key string) bool {
+	switch strings.ToLower(key) {
+	case "kind", "language", "x-timestamp-map", "region", "style":
+		return true
+	}
+	return false
+}
+
+// updateHeader points the Language field of a WEBVTT header at the target
+// language. When translate is set, the free-text title after the WEBVTT
+// signature and non-metadata fields are translated too.
+func updateHeader(b *block, lang string, translate bool, translateFn func(string) (string, error)) {
+	for i, line := range b.lines {
+		var prefix, value string
+		if i == 0 {
+			// "WEBVTT - Title": keep the signature and dash, translate the title
+			value = strings.TrimLeft(strings.TrimPrefix(line, "WEBVTT"), " \t-")
+			prefix = line[:len(line)-len(value)]
+		} else if key, p, v, ok := headerField(line); ok {
+			if strings.EqualFold(key, "language") {
+				b.lines[i] = p + lang
+				continue
+			}
+			if isHeaderMetadata(key) {
+				continue
+			}
+			prefix, value = p, v
+		} else {
+			value = line
+		}
+
+		if !translate || strings.TrimSpace(value) == "" {
+			continue
+		}
+		translated, err := translateFn(value)
+		if err != nil {
+			logError(fmt.Sprintf("Header line error [line %d]: '%s' — %v", b.lineNo+i, line, err))
+			continue
+		}
+		b.lines[i] = prefix + translated
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSubtitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		newline string
+		kinds   []blockKind
+		ids     []string
+		lines   [][]string
+	}{
+		{
+			name:    "webvtt",
+			text:    "\ufeffWEBVTT\n\nNOTE a comment\n\nSTYLE\n::cue { color: red }\n\nintro\n00:01.000 --> 00:02.000 align:start\nHello\nworld\n",
+			newline: "\n",
+			kinds:   []blockKind{blockHeader, blockNote, blockStyle, blockCue},
+			ids:     []string{"", "", "", "intro"},
+			lines:   [][]string{{"WEBVTT"}, {"NOTE a comment"}, {"STYLE", "::cue { color: red }"}, {"Hello", "world"}},
+		},
+		{
+			name:    "srt with CRLF",
+			text:    "1\r\n00:00:01,000 --> 00:00:02,000\r\nOne\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nTwo\r\n",
+			newline: "\r\n",
+			kinds:   []blockKind{blockCue, blockCue},
+			ids:     []string{"1", "2"},
+			lines:   [][]string{{"One"}, {"Two"}},
+		},
+		{
+			name:    "cue without text",
+			text:    "WEBVTT\n\n00:01.000 --> 00:02.000\n\n00:03.000 --> 00:04.000\nText\n",
+			newline: "\n",
+			kinds:   []blockKind{blockHeader, blockCue, blockCue},
+			ids:     []string{"", "", ""},
+			lines:   [][]string{{"WEBVTT"}, {}, {"Text"}},
+		},
+		{
+			name:    "not a cue",
+			text:    "just some text\nover two lines\n",
+			newline: "\n",
+			kinds:   []blockKind{blockOther},
+			ids:     []string{""},
+			lines:   [][]string{{"just some text", "over two lines"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, newline := splitLines(tt.text)
+			if newline != tt.newline {
+				t.Errorf("newline = %q, want %q", newline, tt.newline)
+			}
+			doc := parseSubtitle(lines, newline)
+			if len(doc.blocks) != len(tt.kinds) {
+				t.Fatalf("got %d blocks, want %d", len(doc.blocks), len(tt.kinds))
+			}
+			for i, b := range doc.blocks {
+				if b.kind != tt.kinds[i] || b.id != tt.ids[i] || !slices.Equal(b.lines, tt.lines[i]) {
+					t.Errorf("block %d = {%v %q %q}, want {%v %q %q}", i, b.kind, b.id, b.lines, tt.kinds[i], tt.ids[i], tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSubtitleRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"WEBVTT\n\nintro\n00:01.000 --> 00:02.500 line:90%\n<i>Hello</i>\n\n00:00:03.000 --> 00:00:04.000\nBye\n",
+		"1\r\n00:00:01,000 --> 00:00:02,000\r\nOne\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nTwo\r\n",
+	} {
+		lines, newline := splitLines(text)
+		if got := parseSubtitle(lines, newline).render(); got != text {
+			t.Errorf("render() = %q, want %q", got, text)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cueTiming is a parsed "start --> end [settings]" line. The settings
+// (WebVTT "position:10% align:start", SRT "X1:... Y2:...") are kept as
+// written, and the timestamp style is remembered so re-rendered lines look
+// like the ones in the source file.
+type cueTiming struct {
+	start    time.Duration
+	end      time.Duration
+	settings string
+	comma    bool // SRT-style "00:00:01,000"
+	short    bool // WebVTT "mm:ss.ttt" without hours
+}
+
+func parseTiming(line string) (cueTiming, bool) {
+	left, right, ok := strings.Cut(line, "-->")
+	if !ok {
+		return cueTiming{}, false
+	}
+
+	startStr := strings.TrimSpace(left)
+	endStr := strings.TrimLeft(right, " \t")
+	settings := ""
+	if i := strings.IndexAny(endStr, " \t"); i >= 0 {
+		endStr, settings = endStr[:i], endStr[i+1:]
+	}
+
+	start, ok := parseTimestamp(startStr)
+	if !ok {
+		return cueTiming{}, false
+	}
+	end, ok := parseTimestamp(endStr)
+	if !ok {
+		return cueTiming{}, false
+	}
+
+	return cueTiming{
+		start:    start,
+		end:      end,
+		settings: strings.TrimSpace(settings),
+		comma:    strings.Contains(startStr, ","),
+		short:    strings.Count(startStr, ":") == 1,
+	}, true
+}
+
+// parseTimestamp accepts "hh:mm:ss.ttt", "mm:ss.ttt" and the SRT comma
+// variant "hh:mm:ss,ttt".
+func parseTimestamp(s string) (time.Duration, bool) {
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	secStr, fracStr, _ := strings.Cut(parts[len(parts)-1], ".")
+	sec, err := strconv.Atoi(secStr)
+	if err != nil || sec < 0 || sec > 59 {
+		return 0, false
+	}
+	var ms int
+	if fracStr != "" {
+		// Tolerate fewer or more than three fractional digits
+		fracStr = (fracStr + "00")[:3]
+		if ms, err = strconv.Atoi(fracStr); err != nil {
+			return 0, false
+		}
+	}
+
+	var total time.Duration
+	for _, p := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		total = total*60 + time.Duration(n)
+	}
+	total = total*60 + time.Duration(sec)
+	return total*time.Second + time.Duration(ms)*time.Millisecond, true
+}
+
+func formatTimestamp(d time.Duration, comma, short bool) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Round(time.Millisecond).Milliseconds()
+	h, m, sec, frac := ms/3600000, ms/60000%60, ms/1000%60, ms%1000
+
+	sep := "."
+	if comma {
+		sep = ","
+	}
+	if short && h == 0 {
+		return fmt.Sprintf("%02d:%02d%s%03d", m, sec, sep, frac)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, sec, sep, frac)
+}
+
+func (t cueTiming) String() string {
+	line := formatTimestamp(t.start, t.comma, t.short) + " --> " + formatTimestamp(t.end, t.comma, t.short)
+	if t.settings != "" {
+		line += " " + t.settings
+	}
+	return line
+}
+
+// retime applies a linear correction t*scale + shift to every cue, the same
+// resync a player would need: scale fixes drift, shift fixes a constant offset.
+func (s *subtitle) retime(shift time.Duration, scale float64) {
+	if shift == 0 && scale == 1 {
+		return
+	}
+	adjust := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d)*scale) + shift
+	}
+	for _, cue := range s.cues() {
+		cue.setTimes(adjust(cue.times.start), adjust(cue.times.end))
+	}
+}
+
+// fixTiming pulls cue out-times in so that no cue lasts longer than
+// maxDuration and each ends at least minGap before the next cue starts;
+// a zero value disables either fix. In-times never move. It returns the
+// number of cues whose out-time changed.
+func (s *subtitle) fixTiming(minGap, maxDuration time.Duration) int {
+	if minGap <= 0 && maxDuration <= 0 {
+		return 0
+	}
+	cues := s.cues()
+	fixed := 0
+	for i, cue := range cues {
+		end := cue.times.end
+		if maxDuration > 0 && end-cue.times.start > maxDuration {
+			end = cue.times.start + maxDuration
+		}
+		// Cues that start together or out of order cannot be separated by
+		// moving out-times alone
+		if minGap > 0 && i+1 < len(cues) {
+			if next := cues[i+1].times.start; next-minGap > cue.times.start && end > next-minGap {
+				end = next - minGap
+			}
+		}
+		if end != cue.times.end {
+			cue.setTimes(cue.times.start, end)
+			fixed++
+		}
+	}
+	return fixed
+}
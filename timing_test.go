@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// cueDoc builds a document of text cues from start/end pairs in milliseconds.
+func cueDoc(ms ...int) *subtitle {
+	doc := &subtitle{newline: "\n"}
+	for i := 0; i+1 < len(ms); i += 2 {
+		t := cueTiming{start: time.Duration(ms[i]) * time.Millisecond, end: time.Duration(ms[i+1]) * time.Millisecond}
+		doc.blocks = append(doc.blocks, &block{kind: blockCue, timing: t.String(), times: t, lines: []string{"text"}})
+	}
+	return doc
+}
+
+func cueTimes(doc *subtitle) []string {
+	var times []string
+	for _, cue := range doc.cues() {
+		times = append(times, cue.timing)
+	}
+	return times
+}
+
+func TestParseTiming(t *testing.T) {
+	tests := []struct {
+		line string
+		want cueTiming
+		ok   bool
+	}{
+		{"00:00:01.000 --> 00:00:02.500", cueTiming{start: time.Second, end: 2500 * time.Millisecond}, true},
+		{"01:02.5 --> 01:03.25 align:start line:0", cueTiming{start: 62500 * time.Millisecond, end: 63250 * time.Millisecond, settings: "align:start line:0", short: true}, true},
+		{"00:00:01,000 --> 00:00:02,000 X1:10", cueTiming{start: time.Second, end: 2 * time.Second, settings: "X1:10", comma: true}, true},
+		{"00:00:61.000 --> 00:01:02.000", cueTiming{}, false},
+		{"Hello --> world", cueTiming{}, false},
+		{"00:00:01.000", cueTiming{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTiming(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseTiming(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetime(t *testing.T) {
+	tests := []struct {
+		name  string
+		shift time.Duration
+		scale float64
+		want  []string
+	}{
+		{"unchanged", 0, 1, []string{"00:00:01.000 --> 00:00:02.000", "00:00:10.000 --> 00:00:12.000"}},
+		{"shift", 1500 * time.Millisecond, 1, []string{"00:00:02.500 --> 00:00:03.500", "00:00:11.500 --> 00:00:13.500"}},
+		{"negative shift clamps at zero", -1500 * time.Millisecond, 1, []string{"00:00:00.000 --> 00:00:00.500", "00:00:08.500 --> 00:00:10.500"}},
+		{"scale", 0, 1.5, []string{"00:00:01.500 --> 00:00:03.000", "00:00:15.000 --> 00:00:18.000"}},
+		{"scale and shift", -time.Second, 2, []string{"00:00:01.000 --> 00:00:03.000", "00:00:19.000 --> 00:00:23.000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := cueDoc(1000, 2000, 10000, 12000)
+			doc.retime(tt.shift, tt.scale)
+			if got := cueTimes(doc); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixTiming(t *testing.T) {
+	tests := []struct {
+		name        string
+		ms          []int
+		minGap      time.Duration
+		maxDuration time.Duration
+		fixed       int
+		want        []string
+	}{
+		{
+			name:  "disabled",
+			ms:    []int{0, 2000, 1000, 3000},
+			fixed: 0,
+			want:  []string{"00:00:00.000 --> 00:00:02.000", "00:00:01.000 --> 00:00:03.000"},
+		},
+		{
+			name:   "gap before the next cue",
+			ms:     []int{0, 2000, 2000, 3000, 3100, 4000},
+			minGap: 200 * time.Millisecond,
+			fixed:  2,
+			want:   []string{"00:00:00.000 --> 00:00:01.800", "00:00:02.000 --> 00:00:02.900", "00:00:03.100 --> 00:00:04.000"},
+		},
+		{
+			name:        "max duration",
+			ms:          []int{0, 10000, 20000, 21000},
+			maxDuration: 7 * time.Second,
+			fixed:       1,
+			want:        []string{"00:00:00.000 --> 00:00:07.000", "00:00:20.000 --> 00:00:21.000"},
+		},
+		{
+			name:   "cues starting together stay",
+			ms:     []int{1000, 2000, 1000, 3000},
+			minGap: 100 * time.Millisecond,
+			fixed:  0,
+			want:   []string{"00:00:01.000 --> 00:00:02.000", "00:00:01.000 --> 00:00:03.000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := cueDoc(tt.ms...)
+			if fixed := doc.fixTiming(tt.minGap, tt.maxDuration); fixed != tt.fixed {
+				t.Errorf("fixed %d cues, want %d", fixed, tt.fixed)
+			}
+			if got := cueTimes(doc); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}